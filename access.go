@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	authorization "k8s.io/api/authorization/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Access describes where the current user is allowed to list a resource type.
+type Access struct {
+	// ClusterWide is true if the type can be listed across all namespaces
+	ClusterWide bool
+	// Namespaces the type can be listed from, if it can not be listed cluster wide
+	Namespaces []string
+	// Denied are the namespaces the rules allowed, but whose List call was forbidden
+	Denied []string
+}
+
+func (a Access) Allowed() bool {
+	return a.ClusterWide || len(a.Namespaces) > 0
+}
+
+// accessChecker runs SelfSubjectAccessReviews to find out where a type can be listed.
+// Users with only namespace scoped rights get the list of namespaces they can
+// access, so partial reports can be generated instead of failing on Forbidden errors.
+// The namespaces are checked with one SelfSubjectRulesReview per namespace, shared by all types.
+type accessChecker struct {
+	c client.Client
+
+	once       sync.Once
+	namespaces []string
+	nsErr      error
+
+	mu    sync.Mutex
+	rules map[string]*namespaceRules
+}
+
+// namespaceRules are the rules of the current user in a namespace, fetched once.
+type namespaceRules struct {
+	once   sync.Once
+	status authorization.SubjectRulesReviewStatus
+	err    error
+}
+
+func newAccessChecker(c client.Client) *accessChecker {
+	return &accessChecker{c: c, rules: map[string]*namespaceRules{}}
+}
+
+func (a *accessChecker) canList(ctx context.Context, gvr schema.GroupVersionResource, ns string) (bool, error) {
+	review := authorization.SelfSubjectAccessReview{
+		Spec: authorization.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorization.ResourceAttributes{
+				Namespace: ns,
+				Verb:      "list",
+				Group:     gvr.Group,
+				Version:   gvr.Version,
+				Resource:  gvr.Resource,
+			},
+		},
+	}
+	if err := a.c.Create(ctx, &review); err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+func (a *accessChecker) namespaceRules(ctx context.Context, ns string) (*authorization.SubjectRulesReviewStatus, error) {
+	a.mu.Lock()
+	nr, ok := a.rules[ns]
+	if !ok {
+		nr = &namespaceRules{}
+		a.rules[ns] = nr
+	}
+	a.mu.Unlock()
+
+	nr.once.Do(func() {
+		review := authorization.SelfSubjectRulesReview{
+			Spec: authorization.SelfSubjectRulesReviewSpec{Namespace: ns},
+		}
+		nr.err = a.c.Create(ctx, &review)
+		nr.status = review.Status
+	})
+	return &nr.status, nr.err
+}
+
+// canListInNamespace checks the rules of the namespace and falls back to a
+// SelfSubjectAccessReview if the authorizer could not enumerate all of them.
+func (a *accessChecker) canListInNamespace(ctx context.Context, gvr schema.GroupVersionResource, ns string) (bool, error) {
+	status, err := a.namespaceRules(ctx, ns)
+	if err != nil {
+		return false, err
+	}
+	if rulesAllowList(status.ResourceRules, gvr) {
+		return true, nil
+	}
+	if status.Incomplete {
+		return a.canList(ctx, gvr, ns)
+	}
+	return false, nil
+}
+
+func rulesAllowList(rules []authorization.ResourceRule, gvr schema.GroupVersionResource) bool {
+	matches := func(values []string, v string) bool {
+		for _, x := range values {
+			if x == "*" || x == v {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rule := range rules {
+		// rules limited to named objects never allow a list
+		if len(rule.ResourceNames) > 0 {
+			continue
+		}
+		if matches(rule.Verbs, "list") && matches(rule.APIGroups, gvr.Group) && matches(rule.Resources, gvr.Resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidateNamespaces returns all namespaces if they can be listed, otherwise
+// the namespace of the current kubeconfig context.
+func (a *accessChecker) candidateNamespaces(ctx context.Context) ([]string, error) {
+	a.once.Do(func() {
+		var list core.NamespaceList
+		err := a.c.List(ctx, &list)
+		if kerr.IsForbidden(err) {
+			ns, err := kubeconfigNamespace()
+			if err != nil {
+				a.nsErr = err
+				return
+			}
+			a.namespaces = []string{ns}
+			return
+		} else if err != nil {
+			a.nsErr = err
+			return
+		}
+		for _, ns := range list.Items {
+			a.namespaces = append(a.namespaces, ns.Name)
+		}
+	})
+	return a.namespaces, a.nsErr
+}
+
+func (a *accessChecker) Check(ctx context.Context, mapping *meta.RESTMapping) (Access, error) {
+	allowed, err := a.canList(ctx, mapping.Resource, "")
+	if err != nil {
+		return Access{}, err
+	}
+	if allowed {
+		return Access{ClusterWide: true}, nil
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return Access{}, nil
+	}
+
+	namespaces, err := a.candidateNamespaces(ctx)
+	if err != nil {
+		return Access{}, err
+	}
+	var result Access
+	for _, ns := range namespaces {
+		allowed, err := a.canListInNamespace(ctx, mapping.Resource, ns)
+		if err != nil {
+			return Access{}, err
+		}
+		if allowed {
+			result.Namespaces = append(result.Namespaces, ns)
+		}
+	}
+	return result, nil
+}
+
+// clusterUID returns the UID of the kube-system namespace or an empty string if the user can not read it.
+// Archives captured with --redact have no namespace of that name, collect then uses the
+// (hashed) KubernetesInfo.ClusterUID.
+func clusterUID(ctx context.Context, c client.Client) (string, error) {
+	var ns core.Namespace
+	err := c.Get(ctx, client.ObjectKey{Name: metav1.NamespaceSystem}, &ns)
+	if kerr.IsForbidden(err) || kerr.IsNotFound(err) {
+		return "", nil
+	}
+	return string(ns.UID), err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	authorization "k8s.io/api/authorization/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// rbacClient answers access and rules reviews from fixed rules and fails the
+// List calls of the forbidden list kinds.
+type rbacClient struct {
+	client.Client
+	clusterWide bool
+	// rules per namespace returned by SelfSubjectRulesReviews
+	rules map[string]authorization.SubjectRulesReviewStatus
+	// SelfSubjectAccessReview answers keyed by namespace/resource
+	allowed map[string]bool
+	// list kinds, eg, PersistentVolumeClaimList, that can not be listed at all
+	// or, keyed by namespace/kind, in one namespace
+	forbidden map[string]bool
+
+	rulesReviews  int32
+	accessReviews int32
+}
+
+func (c *rbacClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	switch review := obj.(type) {
+	case *authorization.SelfSubjectAccessReview:
+		atomic.AddInt32(&c.accessReviews, 1)
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = c.clusterWide || attrs.Namespace != "" && c.allowed[attrs.Namespace+"/"+attrs.Resource]
+		return nil
+	case *authorization.SelfSubjectRulesReview:
+		atomic.AddInt32(&c.rulesReviews, 1)
+		review.Status = c.rules[review.Spec.Namespace]
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *rbacClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	gvk, err := apiutil.GVKForObject(list, scheme)
+	if err != nil {
+		return err
+	}
+	var lo client.ListOptions
+	lo.ApplyOptions(opts)
+	// unstructured lists carry the kind of their items
+	kind := strings.TrimSuffix(gvk.Kind, "List") + "List"
+	if c.forbidden[kind] || c.forbidden[lo.Namespace+"/"+kind] {
+		return kerr.NewForbidden(schema.GroupResource{Resource: gvk.Kind}, "", errors.New("denied"))
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestAccessChecker(t *testing.T) {
+	listPods := authorization.ResourceRule{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}
+	c := &rbacClient{
+		Client: newTestClient(t,
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		),
+		rules: map[string]authorization.SubjectRulesReviewStatus{
+			"demo":  {ResourceRules: []authorization.ResourceRule{listPods}},
+			"other": {Incomplete: true},
+		},
+		allowed: map[string]bool{"other/pods": true},
+	}
+	checker := newAccessChecker(c)
+
+	check := func(gvk schema.GroupVersionKind) Access {
+		mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		access, err := checker.Check(context.TODO(), mapping)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return access
+	}
+	if got := check(core.SchemeGroupVersion.WithKind("Pod")); !reflect.DeepEqual(got, Access{Namespaces: []string{"demo", "other"}}) {
+		t.Errorf("pods: got %+v", got)
+	}
+	if got := check(core.SchemeGroupVersion.WithKind("PersistentVolumeClaim")); got.Allowed() {
+		t.Errorf("claims: got %+v", got)
+	}
+	if got := check(core.SchemeGroupVersion.WithKind("Node")); got.Allowed() {
+		t.Errorf("nodes: got %+v", got)
+	}
+	// kube-system, demo and other are reviewed once for all types
+	if n := atomic.LoadInt32(&c.rulesReviews); n != 3 {
+		t.Errorf("got %d rules reviews, want 3", n)
+	}
+}
+
+func TestRulesAllowList(t *testing.T) {
+	pods := core.SchemeGroupVersion.WithResource("pods")
+	tests := []struct {
+		name string
+		rule authorization.ResourceRule
+		want bool
+	}{
+		{"exact", authorization.ResourceRule{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"pods"}}, true},
+		{"wildcards", authorization.ResourceRule{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}, true},
+		{"other verb", authorization.ResourceRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}, false},
+		{"other group", authorization.ResourceRule{Verbs: []string{"list"}, APIGroups: []string{"apps"}, Resources: []string{"pods"}}, false},
+		{"subresource", authorization.ResourceRule{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"pods/log"}}, false},
+		{"named", authorization.ResourceRule{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"pods"}, ResourceNames: []string{"a"}}, false},
+	}
+	for _, tt := range tests {
+		if got := rulesAllowList([]authorization.ResourceRule{tt.rule}, pods); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCollectForbiddenNamespace(t *testing.T) {
+	listPods := authorization.ResourceRule{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"pods"}}
+	c := &rbacClient{
+		Client: newTestClient(t,
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+			newPod("demo", "a", "100m", "64Mi"),
+			newPod("demo", "b", "100m", "64Mi"),
+			newPod("other", "c", "100m", "64Mi"),
+		),
+		rules: map[string]authorization.SubjectRulesReviewStatus{
+			"demo":  {ResourceRules: []authorization.ResourceRule{listPods}},
+			"other": {ResourceRules: []authorization.ResourceRule{listPods}},
+		},
+		// the role binding in other was removed after the rules were reviewed
+		forbidden: map[string]bool{"other/PodList": true},
+	}
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+	report, err := collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods}, nil, CalculateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Access[pods]; !reflect.DeepEqual(got, Access{Namespaces: []string{"demo"}, Denied: []string{"other"}}) {
+		t.Errorf("access = %+v", got)
+	}
+	if got := report.Summaries[pods].Spec.Count; got != 2 {
+		t.Errorf("count = %d, want the 2 pods of demo", got)
+	}
+}
@@ -0,0 +1,40 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+)
+
+// v1alpha1 is the storage version and the hub that later versions convert to and from.
+
+// Hub marks this type as a conversion hub.
+func (*GenericResource) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*ResourceSummary) Hub() {}
+
+// Reports written before the types had JSON tags use the Go field names as keys,
+// eg, APIGroup, TotalResource and RoleResourceLimits. The apimachinery decoder
+// matches keys case sensitively and drops them, while encoding/json matches them
+// case insensitively to the camelCase tags. So the specs and the status are
+// decoded with encoding/json to keep the old reports readable.
+//
+// Objects stored in a cluster before the CRDs were installed can not be read
+// this way, since the API server prunes the unknown keys.
+
+// UnmarshalJSON decodes both the current and the untagged format.
+func (in *GenericResourceSpec) UnmarshalJSON(data []byte) error {
+	type plain GenericResourceSpec
+	return json.Unmarshal(data, (*plain)(in))
+}
+
+// UnmarshalJSON decodes both the current format and the untagged status.Result.
+func (in *GenericResourceStatus) UnmarshalJSON(data []byte) error {
+	type plain GenericResourceStatus
+	return json.Unmarshal(data, (*plain)(in))
+}
+
+// UnmarshalJSON decodes both the current and the untagged format, including the modes.
+func (in *ResourceSummarySpec) UnmarshalJSON(data []byte) error {
+	type plain ResourceSummarySpec
+	return json.Unmarshal(data, (*plain)(in))
+}
@@ -0,0 +1,69 @@
+package v1alpha1
+
+import (
+	"io/ioutil"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+)
+
+// decode reads a fixture with the same case sensitive decoder as the clients.
+func decode(t *testing.T, filename string, into runtime.Object) {
+	t.Helper()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := runtime.NewScheme()
+	if err := AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := runtime.DecodeInto(serializer.NewCodecFactory(s).UniversalDeserializer(), data, into); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeUntaggedGenericResource(t *testing.T) {
+	var obj GenericResource
+	decode(t, "testdata/genericresource-untagged.json", &obj)
+
+	spec := obj.Spec
+	if spec.Group != "kubedb.com" || spec.Kind != "Postgres" || spec.Replicas != 3 || spec.Mode != "Cluster" {
+		t.Errorf("spec = %+v", spec)
+	}
+	if spec.RoleReplicas["standby"] != 2 {
+		t.Errorf("role replicas = %v", spec.RoleReplicas)
+	}
+	if cpu := spec.TotalResource.Requests.Cpu(); cpu.Cmp(resource.MustParse("1500m")) != 0 {
+		t.Errorf("total cpu = %v", cpu)
+	}
+	if memory := spec.RoleResourceLimits["primary"][core.ResourceMemory]; memory.Cmp(resource.MustParse("1Gi")) != 0 {
+		t.Errorf("primary memory limit = %v", memory)
+	}
+	if obj.Status.Status != status.InProgressStatus || obj.Status.Message != "Replicas: 2/3" || len(obj.Status.Conditions) != 1 {
+		t.Errorf("status = %+v", obj.Status)
+	}
+}
+
+func TestDecodeUntaggedResourceSummary(t *testing.T) {
+	var obj ResourceSummary
+	decode(t, "testdata/resourcesummary-untagged.json", &obj)
+
+	spec := obj.Spec
+	if spec.APIGroup != "kubedb.com" || spec.Kind != "Postgres" || spec.Count != 1 || spec.Replicas != 3 {
+		t.Errorf("spec = %+v", spec)
+	}
+	if spec.Kubernetes == nil || spec.Kubernetes.Provider != "kind" {
+		t.Errorf("kubernetes = %+v", spec.Kubernetes)
+	}
+	if len(spec.Modes) != 1 || spec.Modes[0].Mode != "Cluster" || spec.Modes[0].Replicas != 3 {
+		t.Errorf("modes = %+v", spec.Modes)
+	}
+	if cpu := spec.AppResource.Requests.Cpu(); cpu.Cmp(resource.MustParse("1500m")) != 0 {
+		t.Errorf("app cpu = %v", cpu)
+	}
+}
@@ -0,0 +1,5 @@
+// Package v1alpha1 contains the GenericResource and ResourceSummary types of the
+// reports.appscode.com API group.
+// +k8s:deepcopy-gen=package
+// +groupName=reports.appscode.com
+package v1alpha1
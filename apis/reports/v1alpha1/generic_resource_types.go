@@ -0,0 +1,70 @@
+package v1alpha1
+
+import (
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+)
+
+const (
+	ResourceKindGenericResource = "GenericResource"
+	ResourceGenericResource     = "genericresource"
+	ResourceGenericResources    = "genericresources"
+)
+
+type PodRole string
+
+type ReplicaList map[PodRole]int64
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Kind",type="string",JSONPath=".spec.kind"
+//+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.replicas"
+//+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status"
+
+// GenericResource is the Schema for any resource supported by resource-metrics library
+type GenericResource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GenericResourceSpec   `json:"spec,omitempty"`
+	Status GenericResourceStatus `json:"status,omitempty"`
+}
+
+type GenericResourceSpec struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+
+	Replicas     int64       `json:"replicas"`
+	RoleReplicas ReplicaList `json:"roleReplicas,omitempty"`
+	Mode         string      `json:"mode,omitempty"`
+
+	TotalResource core.ResourceRequirements `json:"totalResource"`
+	AppResource   core.ResourceRequirements `json:"appResource"`
+
+	RoleResourceLimits   map[PodRole]core.ResourceList `json:"roleResourceLimits,omitempty"`
+	RoleResourceRequests map[PodRole]core.ResourceList `json:"roleResourceRequests,omitempty"`
+}
+
+// GenericResourceStatus is the kstatus of the object.
+// https://github.com/kubernetes-sigs/cli-utils/tree/master/pkg/kstatus
+type GenericResourceStatus struct {
+	// Status is one of InProgress, Failed, Current, Terminating, NotFound or Unknown
+	Status     status.Status      `json:"status,omitempty"`
+	Message    string             `json:"message,omitempty"`
+	Conditions []status.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// GenericResourceList contains a list of GenericResource
+type GenericResourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GenericResource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GenericResource{}, &GenericResourceList{})
+}
@@ -0,0 +1,113 @@
+package v1alpha1
+
+import (
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+const (
+	ResourceKindResourceSummary = "ResourceSummary"
+	ResourceResourceSummary     = "resourcesummary"
+	ResourceResourceSummaries   = "resourcesummaries"
+)
+
+type ResourceSummarySpec struct {
+	Kubernetes    *KubernetesInfo           `json:"kubernetes,omitempty"`
+	APIGroup      string                    `json:"apiGroup"`
+	Kind          string                    `json:"kind"`
+	TotalResource core.ResourceRequirements `json:"totalResource"`
+	AppResource   core.ResourceRequirements `json:"appResource"`
+	Count         int                       `json:"count"`
+	Replicas      int64                     `json:"replicas"`
+	// breakdown by GenericResourceSpec.Mode, eg, Standalone, Cluster, Sharded
+	Modes []ModeSummary `json:"modes,omitempty"`
+}
+
+// ModeSummary is the part of a ResourceSummary for the objects running in one mode.
+type ModeSummary struct {
+	Mode          string                    `json:"mode"`
+	Count         int                       `json:"count"`
+	Replicas      int64                     `json:"replicas"`
+	TotalResource core.ResourceRequirements `json:"totalResource"`
+	AppResource   core.ResourceRequirements `json:"appResource"`
+}
+
+type KubernetesInfo struct {
+	// https://github.com/kmodules/client-go/blob/master/tools/clusterid/lib.go
+	ClusterName  string            `json:"clusterName,omitempty"`
+	ClusterUID   string            `json:"clusterUID,omitempty"`
+	Version      *version.Info     `json:"version,omitempty"`
+	ControlPlane *ControlPlaneInfo `json:"controlPlane,omitempty"`
+	// Provider is the likely distribution or managed service, eg, EKS, GKE, AKS, k3s, kind, OpenShift
+	Provider       string             `json:"provider,omitempty"`
+	Nodes          *NodeInventory     `json:"nodes,omitempty"`
+	StorageClasses []StorageClassInfo `json:"storageClasses,omitempty"`
+	CSIDrivers     []string           `json:"csiDrivers,omitempty"`
+}
+
+// NodeInventory counts nodes by the given attribute value.
+type NodeInventory struct {
+	Count                    int            `json:"count"`
+	Roles                    map[string]int `json:"roles,omitempty"`
+	OperatingSystems         map[string]int `json:"operatingSystems,omitempty"`
+	Architectures            map[string]int `json:"architectures,omitempty"`
+	InstanceTypes            map[string]int `json:"instanceTypes,omitempty"`
+	Zones                    map[string]int `json:"zones,omitempty"`
+	KubeletVersions          map[string]int `json:"kubeletVersions,omitempty"`
+	ContainerRuntimeVersions map[string]int `json:"containerRuntimeVersions,omitempty"`
+}
+
+type StorageClassInfo struct {
+	Name        string `json:"name"`
+	Provisioner string `json:"provisioner"`
+	IsDefault   bool   `json:"isDefault,omitempty"`
+}
+
+// https://github.com/kmodules/client-go/blob/kubernetes-1.16.3/tools/analytics/analytics.go#L66
+type ControlPlaneInfo struct {
+	DNSNames       []string    `json:"dnsNames,omitempty"`
+	EmailAddresses []string    `json:"emailAddresses,omitempty"`
+	IPAddresses    []string    `json:"ipAddresses,omitempty"`
+	URIs           []string    `json:"uris,omitempty"`
+	NotBefore      metav1.Time `json:"notBefore"`
+	NotAfter       metav1.Time `json:"notAfter"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Group",type="string",JSONPath=".spec.apiGroup"
+//+kubebuilder:printcolumn:name="Kind",type="string",JSONPath=".spec.kind"
+//+kubebuilder:printcolumn:name="Count",type="integer",JSONPath=".spec.count"
+//+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.replicas"
+//+kubebuilder:printcolumn:name="Computed",type="date",JSONPath=".status.lastComputedTime"
+
+// ResourceSummary is the Schema for the resourcesummaries API
+type ResourceSummary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ResourceSummarySpec   `json:"spec,omitempty"`
+	Status ResourceSummaryStatus `json:"status,omitempty"`
+}
+
+// ResourceSummaryStatus is written by the in-cluster reporter.
+type ResourceSummaryStatus struct {
+	// LastComputedTime is the time the spec was last computed
+	LastComputedTime *metav1.Time `json:"lastComputedTime,omitempty"`
+	// Errors of the last run, eg, a failed List call. The spec keeps the last computed numbers.
+	Errors []string `json:"errors,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ResourceSummaryList contains a list of ResourceSummary
+type ResourceSummaryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ResourceSummary `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ResourceSummary{}, &ResourceSummaryList{})
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	apps "k8s.io/api/apps/v1"
+	authorization "k8s.io/api/authorization/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Entries of an archive written by capture. Objects are stored one list page per entry,
+// eg, objects/kubedb.com/v1alpha2/Postgres/0.json, core types use the group name "core".
+const (
+	archiveKubernetesInfo     = "kubernetes-info.json"
+	archiveResources          = "api-resources.json"
+	archivePreferredResources = "preferred-resources.json"
+	archiveSkippedTypes       = "skipped-types.json"
+	archiveObjectsDir         = "objects"
+)
+
+// capturedTypes are captured in addition to the registered types, since the reports read them, too.
+var capturedTypes = []schema.GroupVersionKind{
+	core.SchemeGroupVersion.WithKind("Namespace"),
+	core.SchemeGroupVersion.WithKind("Node"),
+	core.SchemeGroupVersion.WithKind("Pod"),
+	core.SchemeGroupVersion.WithKind("PersistentVolume"),
+	core.SchemeGroupVersion.WithKind("PersistentVolumeClaim"),
+	core.SchemeGroupVersion.WithKind("ResourceQuota"),
+	core.SchemeGroupVersion.WithKind("LimitRange"),
+	apps.SchemeGroupVersion.WithKind("StatefulSet"),
+	apps.SchemeGroupVersion.WithKind("ReplicaSet"),
+}
+
+// Archive is a snapshot of a cluster that the reports can run against with --from-archive.
+type Archive struct {
+	KubernetesInfo     *v1alpha1.KubernetesInfo
+	Resources          []*metav1.APIResourceList
+	PreferredResources []*metav1.APIResourceList
+	Objects            []unstructured.Unstructured
+	// Skipped are the types capture could not list, eg, because of a Forbidden error
+	Skipped []SkippedType
+}
+
+// SkippedType is a type that capture could not list and the reason why.
+type SkippedType struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	Reason  string `json:"reason"`
+}
+
+func (t SkippedType) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: t.Group, Version: t.Version, Kind: t.Kind}
+}
+
+func objectsEntry(gvk schema.GroupVersionKind, page int) string {
+	group := gvk.Group
+	if group == "" {
+		group = "core"
+	}
+	return path.Join(archiveObjectsDir, group, gvk.Version, gvk.Kind, fmt.Sprintf("%d.json", page))
+}
+
+type archiveWriter struct {
+	tw  *tar.Writer
+	now time.Time
+}
+
+func (w *archiveWriter) writeJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := w.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: w.now,
+	}); err != nil {
+		return err
+	}
+	_, err = w.tw.Write(data)
+	return err
+}
+
+// Capture writes a gzip compressed tar archive with the cluster info, the discovery
+// resource lists and every object of the given types. Types the user can not list are skipped
+// and recorded, so the reports run against the archive show them without access.
+// Objects are sanitized before they are written, see sanitize.
+func Capture(ctx context.Context, out io.Writer, c client.Client, ki *v1alpha1.KubernetesInfo, resources, preferred []*metav1.APIResourceList, gvks []schema.GroupVersionKind, pageSize int64, r *Redactor) error {
+	gz := gzip.NewWriter(out)
+	w := &archiveWriter{tw: tar.NewWriter(gz), now: time.Now()}
+
+	if err := w.writeJSON(archiveKubernetesInfo, r.KubernetesInfo(ki)); err != nil {
+		return err
+	}
+	if err := w.writeJSON(archiveResources, resources); err != nil {
+		return err
+	}
+	if err := w.writeJSON(archivePreferredResources, preferred); err != nil {
+		return err
+	}
+
+	skipped := []SkippedType{}
+	for _, gvk := range gvks {
+		var cont string
+		for page := 0; ; page++ {
+			var list unstructured.UnstructuredList
+			list.SetGroupVersionKind(gvk)
+			opts := []client.ListOption{client.Continue(cont)}
+			if pageSize > 0 {
+				opts = append(opts, client.Limit(pageSize))
+			}
+			err := c.List(ctx, &list, opts...)
+			if kerr.IsForbidden(err) || meta.IsNoMatchError(err) {
+				klog.Warningf("skipping %s: %v", gvk, err)
+				skipped = append(skipped, SkippedType{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind, Reason: err.Error()})
+				break
+			} else if err != nil {
+				return fmt.Errorf("failed to list %s: %w", gvk, err)
+			}
+			for i := range list.Items {
+				if err := sanitize(&list.Items[i], r); err != nil {
+					return err
+				}
+			}
+			if len(list.Items) > 0 {
+				if err := w.writeJSON(objectsEntry(gvk, page), &list); err != nil {
+					return err
+				}
+			}
+			cont = list.GetContinue()
+			if cont == "" {
+				break
+			}
+		}
+	}
+
+	if err := w.writeJSON(archiveSkippedTypes, skipped); err != nil {
+		return err
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// sanitize removes what the reports never read, but that often holds secrets or
+// personal data: the managed fields, the last applied configuration and the values
+// of environment variables. With a Redactor, the metadata is redacted like in the
+// reports and the names that refer to other objects are hashed the same way, so
+// owners, nodes and volumes are still matched.
+func sanitize(obj *unstructured.Unstructured, r *Redactor) error {
+	obj.SetManagedFields(nil)
+	if annotations := obj.GetAnnotations(); annotations != nil {
+		delete(annotations, core.LastAppliedConfigAnnotation)
+		obj.SetAnnotations(annotations)
+	}
+	blankEnvValues(obj.Object)
+	if r == nil {
+		return nil
+	}
+
+	md, _, err := unstructured.NestedMap(obj.Object, "metadata")
+	if err != nil {
+		return err
+	}
+	var in metav1.ObjectMeta
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(md, &in); err != nil {
+		return err
+	}
+	out := r.ObjectMeta(in)
+	if md, err = runtime.DefaultUnstructuredConverter.ToUnstructured(&out); err != nil {
+		return err
+	}
+	obj.Object["metadata"] = md
+
+	for _, fields := range [][]string{
+		{"spec", "nodeName"},
+		{"spec", "volumeName"},
+		{"spec", "claimRef", "namespace"},
+		{"spec", "claimRef", "name"},
+		{"spec", "claimRef", "uid"},
+	} {
+		if v, found, _ := unstructured.NestedString(obj.Object, fields...); found {
+			if err := unstructured.SetNestedField(obj.Object, r.Hash(v), fields...); err != nil {
+				return err
+			}
+		}
+	}
+	for _, fields := range [][]string{
+		{"status", "hostIP"},
+		{"status", "podIP"},
+		{"status", "podIPs"},
+		{"status", "addresses"},
+	} {
+		unstructured.RemoveNestedField(obj.Object, fields...)
+	}
+	return nil
+}
+
+// blankEnvValues clears the value of every environment variable, wherever a pod template
+// is embedded, eg, in the containers of a Pod, a StatefulSet or a database's podTemplate.
+func blankEnvValues(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if env, ok := field.([]interface{}); ok && k == "env" {
+				for _, e := range env {
+					if e, ok := e.(map[string]interface{}); ok && e["value"] != nil {
+						e["value"] = ""
+					}
+				}
+				continue
+			}
+			blankEnvValues(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			blankEnvValues(item)
+		}
+	}
+}
+
+// LoadArchive reads an archive written by Capture.
+func LoadArchive(filename string) (*Archive, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an archive written by capture: %w", filename, err)
+	}
+	defer gz.Close()
+
+	var a Archive
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(tr)
+		switch {
+		case hdr.Name == archiveKubernetesInfo:
+			err = dec.Decode(&a.KubernetesInfo)
+		case hdr.Name == archiveResources:
+			err = dec.Decode(&a.Resources)
+		case hdr.Name == archivePreferredResources:
+			err = dec.Decode(&a.PreferredResources)
+		case hdr.Name == archiveSkippedTypes:
+			err = dec.Decode(&a.Skipped)
+		case strings.HasPrefix(hdr.Name, archiveObjectsDir+"/"):
+			var list unstructured.UnstructuredList
+			if err = dec.Decode(&list); err == nil {
+				// list items do not always carry their kind
+				gvk := list.GroupVersionKind()
+				gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+				for _, item := range list.Items {
+					item.SetGroupVersionKind(gvk)
+					a.Objects = append(a.Objects, item)
+				}
+			}
+		default:
+			klog.Warningf("skipping unknown archive entry %s", hdr.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", hdr.Name, err)
+		}
+	}
+	if a.KubernetesInfo == nil || a.Resources == nil {
+		return nil, fmt.Errorf("%s is not an archive written by capture", filename)
+	}
+	return &a, nil
+}
+
+// RESTMapper maps the types that were served by the captured cluster.
+func (a *Archive) RESTMapper() (meta.RESTMapper, error) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, rl := range a.Resources {
+		gv, err := schema.ParseGroupVersion(rl.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rl.APIResources {
+			if strings.Contains(r.Name, "/") {
+				continue
+			}
+			singular := r.SingularName
+			if singular == "" {
+				singular = strings.ToLower(r.Kind)
+			}
+			scope := meta.RESTScopeRoot
+			if r.Namespaced {
+				scope = meta.RESTScopeNamespace
+			}
+			mapper.AddSpecific(gv.WithKind(r.Kind), gv.WithResource(r.Name), gv.WithResource(singular), scope)
+		}
+	}
+	return mapper, nil
+}
+
+// Client returns a read only view of the archive. Built-in types are stored typed, so they
+// can be listed both typed and unstructured, everything else is kept as captured.
+func (a *Archive) Client() (client.Client, error) {
+	mapper, err := a.RESTMapper()
+	if err != nil {
+		return nil, err
+	}
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		return nil, err
+	}
+
+	objects := make([]runtime.Object, 0, len(a.Objects))
+	for i := range a.Objects {
+		item := &a.Objects[i]
+		gvk := item.GroupVersionKind()
+		if !s.Recognizes(gvk) {
+			objects = append(objects, item)
+			continue
+		}
+		obj, err := s.New(gvk)
+		if err != nil {
+			return nil, err
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, obj); err != nil {
+			return nil, fmt.Errorf("failed to convert %s %s/%s: %w", gvk, item.GetNamespace(), item.GetName(), err)
+		}
+		objects = append(objects, obj)
+	}
+
+	// The fake client registers the unstructured list kinds that its scheme does not
+	// recognize on the first List call, which races with concurrent lists. So every
+	// served kind is registered upfront.
+	for _, rl := range a.Resources {
+		gv, err := schema.ParseGroupVersion(rl.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rl.APIResources {
+			if gvk := gv.WithKind(r.Kind); !strings.Contains(r.Name, "/") && !s.Recognizes(gvk) {
+				s.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+				s.AddKnownTypeWithName(gv.WithKind(r.Kind+"List"), &unstructured.UnstructuredList{})
+			}
+		}
+	}
+
+	// types that are no longer served have no mapping and are never checked
+	denied := map[schema.GroupResource]bool{}
+	for _, t := range a.Skipped {
+		gvk := t.GroupVersionKind()
+		if mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			denied[mapping.Resource.GroupResource()] = true
+		}
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(s).
+		WithRuntimeObjects(objects...).
+		Build()
+	return archiveClient{Client: c, mapper: mapper, denied: denied}, nil
+}
+
+// archiveClient answers the access reviews with what the user running capture could list:
+// every type is allowed in all namespaces, except the skipped ones, which are allowed nowhere.
+// The fake client has no RESTMapper of its own.
+type archiveClient struct {
+	client.Client
+	mapper meta.RESTMapper
+	denied map[schema.GroupResource]bool
+}
+
+func (c archiveClient) RESTMapper() meta.RESTMapper {
+	return c.mapper
+}
+
+// List serves metadata only lists of the types without a Go type from the stored
+// unstructured objects, since the fake client can not convert those.
+func (c archiveClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	ml, ok := list.(*metav1.PartialObjectMetadataList)
+	if !ok || ml.GroupVersionKind().Kind == "" {
+		return c.Client.List(ctx, list, opts...)
+	}
+	gvk := ml.GroupVersionKind()
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	if clientgoscheme.Scheme.Recognizes(gvk) {
+		return c.Client.List(ctx, list, opts...)
+	}
+
+	var ul unstructured.UnstructuredList
+	ul.SetGroupVersionKind(ml.GroupVersionKind())
+	if err := c.Client.List(ctx, &ul, opts...); err != nil {
+		return err
+	}
+	ml.Items = make([]metav1.PartialObjectMetadata, 0, len(ul.Items))
+	for _, item := range ul.Items {
+		obj := metav1.PartialObjectMetadata{TypeMeta: metav1.TypeMeta{APIVersion: item.GetAPIVersion(), Kind: item.GetKind()}}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &obj); err != nil {
+			return err
+		}
+		ml.Items = append(ml.Items, obj)
+	}
+	return nil
+}
+
+func (c archiveClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	switch review := obj.(type) {
+	case *authorization.SelfSubjectAccessReview:
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = attrs == nil || !c.denied[schema.GroupResource{Group: attrs.Group, Resource: attrs.Resource}]
+		return nil
+	case *authorization.SelfSubjectRulesReview:
+		// only the skipped types are checked per namespace, since all others are allowed cluster wide
+		review.Status = authorization.SubjectRulesReviewStatus{}
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
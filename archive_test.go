@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var updateFixtures = flag.Bool("update", false, "Rewrite the archive in testdata")
+
+// testArchive is replayed by the --from-archive tests. It was captured by a user
+// who could not list MongoDB. Regenerate it with go test -run TestCapture -update.
+const testArchive = "testdata/cluster.tar.gz"
+
+// forbiddenClient returns Forbidden for every list of kind.
+type forbiddenClient struct {
+	client.Client
+	kind schema.GroupVersionKind
+}
+
+func (c forbiddenClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	gvk := list.GetObjectKind().GroupVersionKind()
+	if strings.TrimSuffix(gvk.Kind, "List") == c.kind.Kind && gvk.Group == c.kind.Group {
+		return kerr.NewForbidden(schema.GroupResource{Group: c.kind.Group, Resource: "mongodbs"}, "", errors.New("not allowed"))
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func captureTestArchive(t *testing.T, r *Redactor) []byte {
+	t.Helper()
+	objs := []runtime.Object{
+		newPod("demo", "web", "500m", "256Mi"),
+		newPostgres(t, "demo", "pg-a", "1"),
+		newPostgres(t, "demo", "pg-b", "2"),
+		parseObject(t, `
+apiVersion: kubedb.com/v1alpha2
+kind: MongoDB
+metadata:
+  namespace: demo
+  name: mg
+spec:
+  replicas: 1
+`),
+	}
+	c := forbiddenClient{Client: newTestClient(t, objs...), kind: testMongoDB}
+	gvks := append(append([]schema.GroupVersionKind{}, capturedTypes...), testPostgres, testMongoDB)
+
+	var buf bytes.Buffer
+	if err := Capture(context.TODO(), &buf, c, testKubernetesInfo(), testResources, testResources, gvks, 1, r); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCapture(t *testing.T) {
+	data := captureTestArchive(t, nil)
+	if *updateFixtures {
+		if err := ioutil.WriteFile(testArchive, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filename := filepath.Join(t.TempDir(), "cluster.tar.gz")
+	if err := ioutil.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadArchive(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Skipped) != 1 || a.Skipped[0].GroupVersionKind() != testMongoDB || !strings.Contains(a.Skipped[0].Reason, "forbidden") {
+		t.Errorf("skipped = %+v", a.Skipped)
+	}
+	// kube-system, one pod and two Postgres
+	if len(a.Objects) != 4 {
+		t.Errorf("got %d objects", len(a.Objects))
+	}
+}
+
+func TestCaptureRedacted(t *testing.T) {
+	r := &Redactor{salt: []byte("salt")}
+	filename := filepath.Join(t.TempDir(), "cluster.tar.gz")
+	if err := ioutil.WriteFile(filename, captureTestArchive(t, r), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadArchive(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.KubernetesInfo.ClusterUID != r.Hash(testKubernetesInfo().ClusterUID) {
+		t.Errorf("cluster uid = %s", a.KubernetesInfo.ClusterUID)
+	}
+	c, err := a.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := collect(context.TODO(), c, a.KubernetesInfo, []schema.GroupVersionKind{testPostgres}, nil, CalculateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Namespaces[testPostgres]; !reflect.DeepEqual(got, map[string]int{r.Hash("demo"): 2}) {
+		t.Errorf("namespaces = %v", got)
+	}
+	if report.ClusterID != a.KubernetesInfo.ClusterUID {
+		t.Errorf("cluster id = %q", report.ClusterID)
+	}
+}
+
+func TestArchiveAccess(t *testing.T) {
+	a, err := LoadArchive(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := a.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := collect(context.TODO(), c, a.KubernetesInfo, []schema.GroupVersionKind{testPods, testPostgres, testMongoDB}, nil, CalculateOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access := report.Access[testMongoDB]; access.Allowed() {
+		t.Errorf("skipped MongoDB access = %+v", access)
+	}
+	if access := report.Access[testPostgres]; !access.ClusterWide {
+		t.Errorf("Postgres access = %+v", access)
+	}
+	if got := report.Summaries[testPostgres].Spec.Count; got != 2 {
+		t.Errorf("Postgres count = %d, want 2", got)
+	}
+}
+
+// replay runs a command against testArchive. The first argument is the command.
+func replay(t *testing.T, args ...string) error {
+	t.Helper()
+	t.Cleanup(func() {
+		fromArchive, snapshot = "", nil
+	})
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+	// the flags end at the first argument of the command
+	return run(context.TODO(), append([]string{args[0], "--from-archive", testArchive}, args[1:]...))
+}
+
+func TestReplayCheck(t *testing.T) {
+	policy := writePolicy(t, `
+rules:
+- kinds: ["Postgres.kubedb.com"]
+  maxCount: 1
+`)
+	err := replay(t, "check", "--policy", policy, "--selector", "k8s.io/group=kubedb.com")
+	var ee exitError
+	if !errors.As(err, &ee) || ee.code != int(CheckCritical) || ee.msg != "1 policy violation(s)" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestReplayWebhook(t *testing.T) {
+	err := replay(t, "webhook", "--policy", writePolicy(t, "rules: []\n"))
+	if err == nil || err.Error() != "webhook can not be used with --from-archive" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	newObject := func() *unstructured.Unstructured {
+		return parseObject(t, `
+apiVersion: v1
+kind: Pod
+metadata:
+  namespace: demo
+  name: web
+  labels:
+    app: web
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: '{"password":"secret"}'
+    team: payments
+  managedFields:
+  - manager: kubectl
+    operation: Apply
+spec:
+  nodeName: node-1
+  initContainers:
+  - name: init
+    env:
+    - name: TOKEN
+      value: secret
+  containers:
+  - name: web
+    env:
+    - name: PASSWORD
+      value: secret
+    - name: HOST
+      valueFrom:
+        fieldRef:
+          fieldPath: status.hostIP
+status:
+  phase: Running
+  podIP: 10.0.0.1
+`)
+	}
+	env := func(obj *unstructured.Unstructured, field string) []interface{} {
+		containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", field)
+		return containers[0].(map[string]interface{})["env"].([]interface{})
+	}
+
+	obj := newObject()
+	if err := sanitize(obj, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(obj.GetManagedFields()) != 0 || !reflect.DeepEqual(obj.GetAnnotations(), map[string]string{"team": "payments"}) {
+		t.Errorf("metadata = %+v", obj.Object["metadata"])
+	}
+	for _, field := range []string{"containers", "initContainers"} {
+		if v := env(obj, field)[0].(map[string]interface{})["value"]; v != "" {
+			t.Errorf("%s: env value = %v", field, v)
+		}
+	}
+	if _, found := env(obj, "containers")[1].(map[string]interface{})["valueFrom"]; !found {
+		t.Error("valueFrom was removed")
+	}
+	if obj.GetName() != "web" || obj.GetLabels()["app"] != "web" {
+		t.Errorf("identifiers changed without a redactor: %+v", obj.Object["metadata"])
+	}
+
+	r := &Redactor{salt: []byte("salt")}
+	obj = newObject()
+	if err := sanitize(obj, r); err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetNamespace() != r.Hash("demo") || obj.GetName() != r.Hash("web") || obj.GetLabels()["app"] != r.Hash("web") || obj.GetAnnotations() != nil {
+		t.Errorf("metadata = %+v", obj.Object["metadata"])
+	}
+	if node, _, _ := unstructured.NestedString(obj.Object, "spec", "nodeName"); node != r.Hash("node-1") {
+		t.Errorf("node = %s", node)
+	}
+	if _, found, _ := unstructured.NestedString(obj.Object, "status", "podIP"); found {
+		t.Error("pod IP was kept")
+	}
+	if phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase"); phase != "Running" {
+		t.Errorf("phase = %s", phase)
+	}
+	// the kind is needed to read the archive
+	if obj.GroupVersionKind() != testPods {
+		t.Errorf("gvk = %v", obj.GroupVersionKind())
+	}
+}
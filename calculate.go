@@ -5,111 +5,587 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"text/tabwriter"
 
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
 	core "k8s.io/api/core/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/selection"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
-	cu "kmodules.xyz/client-go/client"
 	resourcemetrics "kmodules.xyz/resource-metrics"
 	"kmodules.xyz/resource-metrics/api"
 	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func GetAPIGroups(s labels.Selector) sets.String {
-	g, found := s.RequiresExactMatch("k8s.io/group")
-	if found {
-		return sets.NewString(g)
+// Labels used to select resource types with a label selector, eg,
+// 'k8s.io/group notin (apps),k8s.io/kind in (Postgres,MySQL)'
+const (
+	LabelGroup    = "k8s.io/group"
+	LabelVersion  = "k8s.io/version"
+	LabelKind     = "k8s.io/kind"
+	LabelResource = "k8s.io/resource"
+	// Namespaced or Cluster
+	LabelScope = "k8s.io/scope"
+	// set to "true" for every category of the resource, eg, category.k8s.io/all=true
+	LabelCategoryPrefix = "category.k8s.io/"
+)
+
+// GVKLabels returns the label set of a resource type. The discovery info is optional,
+// without it only the group, version and kind labels are set.
+func GVKLabels(gvk schema.GroupVersionKind, r *metav1.APIResource) labels.Set {
+	set := labels.Set{
+		LabelGroup:   gvk.Group,
+		LabelVersion: gvk.Version,
+		LabelKind:    gvk.Kind,
+	}
+	if r == nil {
+		return set
+	}
+	set[LabelResource] = r.Name
+	if r.Namespaced {
+		set[LabelScope] = string(apiextensions.NamespaceScoped)
+	} else {
+		set[LabelScope] = string(apiextensions.ClusterScoped)
 	}
+	for _, category := range r.Categories {
+		set[LabelCategoryPrefix+category] = "true"
+	}
+	return set
+}
 
-	requirements, selectable := s.Requirements()
-	if selectable {
-		for _, r := range requirements {
-			if r.Key() == "k8s.io/group" && r.Operator() == selection.In {
-				return r.Values()
+// SelectGVKs returns the types whose labels match the selector, sorted by group, version and kind.
+func SelectGVKs(s labels.Selector, gvks []schema.GroupVersionKind, resources map[schema.GroupVersionKind]metav1.APIResource) []schema.GroupVersionKind {
+	result := make([]schema.GroupVersionKind, 0, len(gvks))
+	for _, gvk := range gvks {
+		var r *metav1.APIResource
+		if res, ok := resources[gvk]; ok {
+			r = &res
+		}
+		if s.Matches(GVKLabels(gvk, r)) {
+			result = append(result, gvk)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Group != result[j].Group {
+			return result[i].Group < result[j].Group
+		}
+		if result[i].Version != result[j].Version {
+			return result[i].Version < result[j].Version
+		}
+		return result[i].Kind < result[j].Kind
+	})
+	return result
+}
+
+// CalculateOptions controls how the registered resource types are listed.
+type CalculateOptions struct {
+	// number of GVKs listed in parallel
+	Concurrency int
+	// maximum number of objects fetched per List call
+	PageSize int64
+	// retain every GenericResource for per object output
+	ShowObjects bool
+	// use metadata only lists and skip the resource calculators,
+	// except for the kinds in ResourceKinds
+	CountOnly bool
+	// GroupKinds (eg, Postgres.kubedb.com) whose resources are calculated in CountOnly mode
+	ResourceKinds sets.String
+	// label key used to group object counts, eg, app.kubernetes.io/name
+	GroupLabel string
+	// print the object count per namespace, implied by CountOnly
+	ByNamespace bool
+	// record list errors in the report instead of failing, eg, for unavailable aggregated APIs
+	ContinueOnError bool
+	// limits the objects that are counted
+	Filter ObjectFilter
+	// print the report with a template instead of a table
+	Output OutputOptions
+	// per object --where filter and --column values
+	Expr ExpressionOptions
+	// LimitRanges by namespace whose container defaults are applied before the
+	// resources are calculated. Defaults are only applied if it is not nil.
+	LimitRanges map[string][]core.LimitRange
+}
+
+// Report is the aggregated result of listing the registered resource types.
+type Report struct {
+	ClusterID string
+	Summaries map[schema.GroupVersionKind]v1alpha1.ResourceSummary
+	// where each type available in the cluster could be listed from
+	Access map[schema.GroupVersionKind]Access
+	// types whose listing was cut short by a timeout or interrupt; their summaries are partial
+	Incomplete map[schema.GroupVersionKind]bool
+	// types listed with metadata only lists, so they have a count but no resources
+	MetadataOnly map[schema.GroupVersionKind]bool
+	// object count per namespace
+	Namespaces map[schema.GroupVersionKind]map[string]int
+	// object count per value of CalculateOptions.GroupLabel
+	LabelGroups map[schema.GroupVersionKind]map[string]int
+	// types that could not be listed, only populated if CalculateOptions.ContinueOnError is set
+	Errors map[schema.GroupVersionKind]error
+	// only populated if CalculateOptions.ShowObjects is set
+	Objects []v1alpha1.GenericResource
+	// listed objects keyed by rawObjectKey, only populated for templates using them without redaction
+	RawObjects map[string]map[string]interface{}
+	// --column values keyed by rawObjectKey of the (redacted) object
+	Columns map[string][]string
+	// objectRefs of the objects whose resources include LimitRange defaults
+	Estimated sets.String
+}
+
+// gvkResult is the outcome of listing a single type.
+type gvkResult struct {
+	Summary      v1alpha1.ResourceSummary
+	Objects      []v1alpha1.GenericResource
+	RawObjects   map[string]map[string]interface{}
+	Columns      map[string][]string
+	Estimated    []string
+	Access       *Access
+	MetadataOnly bool
+	Namespaces   map[string]int
+	LabelGroups  map[string]int
+}
+
+func (report *Report) add(gvk schema.GroupVersionKind, result gvkResult) {
+	report.Summaries[gvk] = result.Summary
+	report.Objects = append(report.Objects, result.Objects...)
+	for k, v := range result.RawObjects {
+		report.RawObjects[k] = v
+	}
+	for k, v := range result.Columns {
+		report.Columns[k] = v
+	}
+	report.Estimated.Insert(result.Estimated...)
+	if result.Access != nil {
+		report.Access[gvk] = *result.Access
+	}
+	if result.MetadataOnly {
+		report.MetadataOnly[gvk] = true
+	}
+	if len(result.Namespaces) > 0 {
+		report.Namespaces[gvk] = result.Namespaces
+	}
+	if len(result.LabelGroups) > 0 {
+		report.LabelGroups[gvk] = result.LabelGroups
+	}
+}
+
+// registeredGVKs returns the types with a resource calculator that match the selector.
+func registeredGVKs(s labels.Selector, resources map[schema.GroupVersionKind]metav1.APIResource) []schema.GroupVersionKind {
+	return SelectGVKs(s, api.RegisteredTypes(), resources)
+}
+
+// preferredGVKs keeps a single version of every GroupKind, the preferred one if it is served,
+// so that objects served under several versions, eg, CronJob in batch/v1 and batch/v1beta1,
+// are only counted once.
+func preferredGVKs(gvks []schema.GroupVersionKind, preferred map[schema.GroupVersionKind]metav1.APIResource) []schema.GroupVersionKind {
+	chosen := map[schema.GroupKind]schema.GroupVersionKind{}
+	for _, gvk := range gvks {
+		if cur, ok := chosen[gvk.GroupKind()]; ok {
+			if _, isPreferred := preferred[cur]; isPreferred {
+				continue
+			}
+			if _, isPreferred := preferred[gvk]; !isPreferred {
+				continue
 			}
 		}
+		chosen[gvk.GroupKind()] = gvk
+	}
+	result := make([]schema.GroupVersionKind, 0, len(chosen))
+	for _, gvk := range gvks {
+		if chosen[gvk.GroupKind()] == gvk {
+			result = append(result, gvk)
+		}
 	}
-	return sets.NewString()
+	return result
+}
+
+func hasCalculator(gvk schema.GroupVersionKind) bool {
+	var u unstructured.Unstructured
+	u.SetGroupVersionKind(gvk)
+	_, err := api.Load(u.Object)
+	return err == nil
 }
 
-func calculate(c client.Client, ki *KubernetesInfo, apiGroups sets.String) error {
-	clusterID, err := cu.ClusterUID(c)
+func calculate(ctx context.Context, c client.Client, ki *v1alpha1.KubernetesInfo, gvks []schema.GroupVersionKind, r *Redactor, opts CalculateOptions) error {
+	report, err := collect(ctx, c, ki, gvks, r, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Output.Enabled() {
+		err = opts.Output.Print(os.Stdout, report, r, opts.Expr.Columns.Names())
+	} else {
+		err = printReport(report, r, opts)
+	}
 	if err != nil {
 		return err
 	}
+	if len(report.Incomplete) > 0 {
+		return incompleteError(ctx)
+	}
+	return nil
+}
+
+// collect lists and aggregates the selected types. If ctx is cancelled, the
+// summaries gathered so far are returned with the unfinished types marked Incomplete.
+func collect(ctx context.Context, c client.Client, ki *v1alpha1.KubernetesInfo, selected []schema.GroupVersionKind, r *Redactor, opts CalculateOptions) (*Report, error) {
+	clusterID, err := clusterUID(ctx, c)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	if clusterID == "" && ki != nil {
+		clusterID = ki.ClusterUID
+	}
+
+	report := Report{
+		ClusterID:    clusterID,
+		Summaries:    map[schema.GroupVersionKind]v1alpha1.ResourceSummary{},
+		Access:       map[schema.GroupVersionKind]Access{},
+		Incomplete:   map[schema.GroupVersionKind]bool{},
+		MetadataOnly: map[schema.GroupVersionKind]bool{},
+		Namespaces:   map[schema.GroupVersionKind]map[string]int{},
+		LabelGroups:  map[schema.GroupVersionKind]map[string]int{},
+		Errors:       map[schema.GroupVersionKind]error{},
+		RawObjects:   map[string]map[string]interface{}{},
+		Columns:      map[string][]string{},
+		Estimated:    sets.NewString(),
+	}
+	checker := newAccessChecker(c)
 
-	rsList := make([]GenericResource, 0)
-	// summaryList := make([]ResourceSummary, 0)
+	gvks := make(chan schema.GroupVersionKind)
+	go func() {
+		defer close(gvks)
+		for _, gvk := range selected {
+			select {
+			case gvks <- gvk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-	rsmap := map[schema.GroupVersionKind]ResourceSummary{}
 	var (
-		totalCount int
-		rrTotal    core.ResourceList
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		errList []error
 	)
-	for _, gvk := range api.RegisteredTypes() {
-		if apiGroups.Len() > 0 && !apiGroups.Has(gvk.Group) {
-			continue
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for gvk := range gvks {
+				result, err := collectGVK(ctx, c, checker, gvk, ki, r, opts)
+				mu.Lock()
+				if err != nil && ctx.Err() != nil {
+					report.add(gvk, result)
+					report.Incomplete[gvk] = true
+				} else if err != nil && opts.ContinueOnError {
+					report.Summaries[gvk] = v1alpha1.ResourceSummary{}
+					report.Errors[gvk] = err
+				} else if err != nil {
+					errList = append(errList, fmt.Errorf("failed to list %v: %w", gvk, err))
+				} else {
+					report.add(gvk, result)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(errList) > 0 {
+		return nil, utilerrors.NewAggregate(errList)
+	}
+	if ctx.Err() != nil {
+		// types never picked up by a worker
+		for _, gvk := range selected {
+			if _, found := report.Summaries[gvk]; !found {
+				report.Summaries[gvk] = v1alpha1.ResourceSummary{}
+				report.Incomplete[gvk] = true
+			}
 		}
+	}
 
-		_, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
-		if meta.IsNoMatchError(err) {
-			rsmap[gvk] = ResourceSummary{} // keep track
-			continue
-		} else if err != nil {
-			return err
+	sort.Slice(report.Objects, func(i, j int) bool {
+		x, y := report.Objects[i], report.Objects[j]
+		if x.Spec.Group != y.Spec.Group {
+			return x.Spec.Group < y.Spec.Group
 		}
-
-		var result unstructured.UnstructuredList
-		result.SetGroupVersionKind(gvk)
-		if err := c.List(context.TODO(), &result); err != nil {
-			return err
+		if x.Spec.Kind != y.Spec.Kind {
+			return x.Spec.Kind < y.Spec.Kind
+		}
+		if x.Namespace != y.Namespace {
+			return x.Namespace < y.Namespace
 		}
+		return x.Name < y.Name
+	})
+	return &report, nil
+}
+
+// collectGVK lists one resource type page by page and aggregates each page
+// into the summary, so only a single page of raw objects is held in memory.
+// Types the user can not list are returned with an empty Access instead of an error.
+func collectGVK(ctx context.Context, c client.Client, checker *accessChecker, gvk schema.GroupVersionKind, ki *v1alpha1.KubernetesInfo, r *Redactor, opts CalculateOptions) (gvkResult, error) {
+	mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return gvkResult{}, nil // keep track
+	} else if err != nil {
+		return gvkResult{}, err
+	}
 
-		summary := ResourceSummary{
+	access, err := checker.Check(ctx, mapping)
+	if err != nil {
+		return gvkResult{}, err
+	}
+	if !access.Allowed() {
+		return gvkResult{Access: &access}, nil
+	}
+
+	result := gvkResult{
+		Summary: v1alpha1.ResourceSummary{
 			TypeMeta: metav1.TypeMeta{},
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      gvk.GroupKind().String(),
 				Namespace: "",
 			},
-			Spec: ResourceSummarySpec{
-				Kubernetes: ki,
+			Spec: v1alpha1.ResourceSummarySpec{
+				Kubernetes: r.KubernetesInfo(ki),
 				APIGroup:   gvk.Group,
 				Kind:       gvk.Kind,
 				// TotalResource: core.ResourceRequirements{},
 				// AppResource:   core.ResourceRequirements{},
 				Count: 0,
 			},
+		},
+		Access:       &access,
+		MetadataOnly: !hasCalculator(gvk) || (opts.CountOnly && !opts.ResourceKinds.Has(gvk.GroupKind().String())),
+		Namespaces:   map[string]int{},
+		LabelGroups:  map[string]int{},
+		RawObjects:   map[string]map[string]interface{}{},
+		Columns:      map[string][]string{},
+	}
+	if result.MetadataOnly && opts.Expr.CallsFunctions() {
+		// eg, a kind without a resource calculator
+		return gvkResult{}, fmt.Errorf("%s: %w", gvk.GroupKind(), errMetadataOnlyFunctions)
+	}
+	summary := &result.Summary
+	modes := map[string]*v1alpha1.ModeSummary{}
+	finish := func() gvkResult {
+		setModes(&summary.Spec, modes)
+		return result
+	}
+
+	count := func(obj metav1.Object) {
+		summary.Spec.Count++
+		result.Namespaces[r.Hash(obj.GetNamespace())]++
+		if opts.GroupLabel != "" {
+			v, ok := obj.GetLabels()[opts.GroupLabel]
+			if !ok {
+				v = noneValue
+			}
+			result.LabelGroups[r.Hash(v)]++
+		}
+	}
+	fn := func(item unstructured.Unstructured) error {
+		if !opts.Filter.Matches(&item) {
+			return nil
+		}
+		if ok, err := opts.Expr.Match(item.Object); err != nil || !ok {
+			return err
+		}
+		estimated := false
+		if opts.LimitRanges != nil {
+			item = *item.DeepCopy()
+			var err error
+			if estimated, err = applyLimitRangeDefaults(item.Object, opts.LimitRanges[item.GetNamespace()]); err != nil {
+				return err
+			}
+		}
+		genres, err := ToGenericResource(item, gvk)
+		if err != nil {
+			return err
+		}
+		if opts.ShowObjects {
+			redacted := r.GenericResource(genres)
+			result.Objects = append(result.Objects, *redacted)
+			if estimated {
+				result.Estimated = append(result.Estimated, objectRef(*redacted))
+			}
+			if opts.Output.Uses("object") && r == nil {
+				result.RawObjects[rawObjectKey(gvk, item.GetNamespace(), item.GetName())] = item.Object
+			}
+			if len(opts.Expr.Columns) > 0 {
+				values, err := opts.Expr.Values(item.Object, r)
+				if err != nil {
+					return err
+				}
+				result.Columns[rawObjectKey(gvk, r.Hash(item.GetNamespace()), r.Hash(item.GetName()))] = values
+			}
+		}
+
+		addToSummary(&summary.Spec, modes, genres.Spec)
+		count(&item)
+		return nil
+	}
+
+	namespaces := access.Namespaces
+	if access.ClusterWide {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	selectors := opts.Filter.ListOptions()
+	for _, ns := range namespaces {
+		if !opts.Filter.MatchesNamespace(ns) {
+			continue
 		}
+		if result.MetadataOnly {
+			err = listMetadataPages(ctx, c, gvk, ns, opts.PageSize, selectors, func(item metav1.PartialObjectMetadata) error {
+				if !opts.Filter.Matches(&item) {
+					return nil
+				}
+				if opts.Expr.Where != "" {
+					// objects counted from metadata are matched against their metadata only
+					obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&item)
+					if err != nil {
+						return err
+					}
+					if ok, err := opts.Expr.Match(obj); err != nil || !ok {
+						return err
+					}
+				}
+				count(&item)
+				return nil
+			})
+		} else {
+			err = listPages(ctx, c, gvk, ns, opts.PageSize, selectors, fn)
+		}
+		if kerr.IsForbidden(err) && ns != metav1.NamespaceAll {
+			// the rules allowed the namespace, but the list was denied, eg, after a role binding
+			// was removed. The other namespaces are still counted.
+			access.Denied = append(access.Denied, ns)
+			continue
+		} else if kerr.IsForbidden(err) {
+			return gvkResult{Access: &Access{}}, nil
+		} else if err != nil && ctx.Err() != nil {
+			// keep what was aggregated before the deadline
+			return finish(), err
+		} else if err != nil {
+			return gvkResult{}, err
+		}
+	}
+	if len(access.Denied) > 0 {
+		access.Namespaces = sets.NewString(access.Namespaces...).Delete(access.Denied...).List()
+	}
+	return finish(), nil
+}
 
+// addToSummary adds the replicas and resources of one object to the summary and to the summary of its mode.
+// The object count is left to the caller, since objects counted from metadata only have no spec.
+func addToSummary(spec *v1alpha1.ResourceSummarySpec, modes map[string]*v1alpha1.ModeSummary, res v1alpha1.GenericResourceSpec) {
+	spec.Replicas += res.Replicas
+	ms, ok := modes[res.Mode]
+	if !ok {
+		ms = &v1alpha1.ModeSummary{Mode: res.Mode}
+		modes[res.Mode] = ms
+	}
+	ms.Count++
+	ms.Replicas += res.Replicas
+	ms.TotalResource.Requests = api.AddResourceList(ms.TotalResource.Requests, res.TotalResource.Requests)
+	ms.TotalResource.Limits = api.AddResourceList(ms.TotalResource.Limits, res.TotalResource.Limits)
+	ms.AppResource.Requests = api.AddResourceList(ms.AppResource.Requests, res.AppResource.Requests)
+	ms.AppResource.Limits = api.AddResourceList(ms.AppResource.Limits, res.AppResource.Limits)
+
+	spec.TotalResource.Requests = api.AddResourceList(spec.TotalResource.Requests, res.TotalResource.Requests)
+	spec.TotalResource.Limits = api.AddResourceList(spec.TotalResource.Limits, res.TotalResource.Limits)
+	spec.AppResource.Requests = api.AddResourceList(spec.AppResource.Requests, res.AppResource.Requests)
+	spec.AppResource.Limits = api.AddResourceList(spec.AppResource.Limits, res.AppResource.Limits)
+}
+
+// setModes fills spec.Modes from the per mode summaries sorted by mode.
+func setModes(spec *v1alpha1.ResourceSummarySpec, modes map[string]*v1alpha1.ModeSummary) {
+	// kinds without modes, eg, Deployments, only have the empty mode
+	if len(modes) == 1 && modes[""] != nil {
+		return
+	}
+	for _, ms := range modes {
+		spec.Modes = append(spec.Modes, *ms)
+	}
+	sort.Slice(spec.Modes, func(i, j int) bool {
+		return spec.Modes[i].Mode < spec.Modes[j].Mode
+	})
+}
+
+// listPages calls fn for every object of the given type in a namespace using Limit/Continue paging.
+func listPages(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, ns string, pageSize int64, selectors []client.ListOption, fn func(item unstructured.Unstructured) error) error {
+	var cont string
+	for {
+		var result unstructured.UnstructuredList
+		result.SetGroupVersionKind(gvk)
+
+		listOpts := append([]client.ListOption{client.InNamespace(ns), client.Continue(cont)}, selectors...)
+		if pageSize > 0 {
+			listOpts = append(listOpts, client.Limit(pageSize))
+		}
+		if err := c.List(ctx, &result, listOpts...); err != nil {
+			return err
+		}
 		for _, item := range result.Items {
-			genres, err := ToGenericResource(item, gvk)
-			if err != nil {
+			if err := fn(item); err != nil {
 				return err
 			}
-			rsList = append(rsList, *genres)
+		}
 
-			summary.Spec.TotalResource.Requests = api.AddResourceList(summary.Spec.TotalResource.Requests, genres.Spec.TotalResource.Requests)
-			summary.Spec.TotalResource.Limits = api.AddResourceList(summary.Spec.TotalResource.Limits, genres.Spec.TotalResource.Limits)
-			summary.Spec.AppResource.Requests = api.AddResourceList(summary.Spec.AppResource.Requests, genres.Spec.AppResource.Requests)
-			summary.Spec.AppResource.Limits = api.AddResourceList(summary.Spec.AppResource.Limits, genres.Spec.AppResource.Limits)
+		cont = result.GetContinue()
+		if cont == "" {
+			return nil
 		}
-		summary.Spec.Count = len(result.Items)
-		rsmap[gvk] = summary
+	}
+}
 
-		// global total
-		totalCount += len(result.Items)
-		rrTotal = api.AddResourceList(rrTotal, summary.Spec.AppResource.Limits)
+// listMetadataPages is like listPages, but only fetches the object metadata.
+func listMetadataPages(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, ns string, pageSize int64, selectors []client.ListOption, fn func(item metav1.PartialObjectMetadata) error) error {
+	var cont string
+	for {
+		var result metav1.PartialObjectMetadataList
+		result.SetGroupVersionKind(gvk)
+
+		listOpts := append([]client.ListOption{client.InNamespace(ns), client.Continue(cont)}, selectors...)
+		if pageSize > 0 {
+			listOpts = append(listOpts, client.Limit(pageSize))
+		}
+		if err := c.List(ctx, &result, listOpts...); err != nil {
+			return err
+		}
+		for _, item := range result.Items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+
+		cont = result.GetContinue()
+		if cont == "" {
+			return nil
+		}
 	}
+}
 
-	gvks := make([]schema.GroupVersionKind, 0, len(rsmap))
-	for gvk := range rsmap {
+func printReport(report *Report, r *Redactor, opts CalculateOptions) error {
+	gvks := make([]schema.GroupVersionKind, 0, len(report.Summaries))
+	for gvk := range report.Summaries {
 		gvks = append(gvks, gvk)
 	}
 	sort.Slice(gvks, func(i, j int) bool {
@@ -119,25 +595,182 @@ func calculate(c client.Client, ki *KubernetesInfo, apiGroups sets.String) error
 		return gvks[i].Group < gvks[j].Group
 	})
 
+	var (
+		totalCount    int
+		totalReplicas int64
+		rrTotal       core.ResourceList
+	)
+
 	const padding = 3
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
 	_, _ = fmt.Fprintln(os.Stdout, "")
+	clusterID := r.Hash(report.ClusterID)
+	if clusterID == "" {
+		clusterID = "unknown"
+	}
 	_, _ = fmt.Fprintf(os.Stdout, "CLUSTER ID: %s\n", clusterID)
 	_, _ = fmt.Fprintln(os.Stdout, "")
-	_, _ = fmt.Fprintln(w, "API VERSION\tKIND\tCOUNT\tCPU\tMEMORY\tSTORAGE\t")
+	_, _ = fmt.Fprintln(w, "API VERSION\tKIND\tCOUNT\tREPLICAS\tCPU\tMEMORY\tSTORAGE\t")
+	var notes summaryNotes
 	for _, gvk := range gvks {
-		rr := rsmap[gvk]
-		if rr.Spec.Count == 0 {
-			_, _ = fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\t\n", gvk.GroupVersion(), gvk.Kind)
-		} else {
-			_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t\n", gvk.GroupVersion(), gvk.Kind, rr.Spec.Count, rr.Spec.AppResource.Limits.Cpu(), rr.Spec.AppResource.Limits.Memory(), rr.Spec.AppResource.Limits.Storage())
+		rr := report.Summaries[gvk]
+		cells, counted := summaryCells(report, gvk, &notes)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t\n", gvk.GroupVersion(), gvk.Kind, strings.Join(cells, "\t"))
+		if !counted {
+			continue
+		}
+		for _, ms := range rr.Spec.Modes {
+			mode := ms.Mode
+			if mode == "" {
+				mode = noneValue
+			}
+			mrl := ms.AppResource.Limits
+			_, _ = fmt.Fprintf(w, "\t  mode=%s\t%d\t%d\t%s\t%s\t%s\t\n", mode, ms.Count, ms.Replicas, mrl.Cpu(), mrl.Memory(), mrl.Storage())
+		}
+
+		// global total
+		totalCount += rr.Spec.Count
+		totalReplicas += rr.Spec.Replicas
+		rrTotal = api.AddResourceList(rrTotal, rr.Spec.AppResource.Limits)
+	}
+	_, _ = fmt.Fprintf(w, "TOTAL\t=\t%d\t%d\t%s\t%s\t%s\t\n", totalCount, totalReplicas, rrTotal.Cpu(), rrTotal.Memory(), rrTotal.Storage())
+	for _, line := range notes.Lines() {
+		_, _ = fmt.Fprintln(w, line)
+	}
+	for _, gvk := range gvks {
+		if err := report.Errors[gvk]; err != nil {
+			_, _ = fmt.Fprintf(w, "error: %s: %v\n", gvk, err)
+		}
+	}
+
+	if opts.CountOnly || opts.ByNamespace {
+		_, _ = fmt.Fprintln(w, "")
+		_, _ = fmt.Fprintln(w, "API VERSION\tKIND\tNAMESPACE\tCOUNT\t")
+		for _, gvk := range gvks {
+			for _, kv := range sortedCounts(report.Namespaces[gvk]) {
+				ns := kv.Key
+				if ns == "" {
+					ns = "-"
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t\n", gvk.GroupVersion(), gvk.Kind, ns, kv.Count)
+			}
+		}
+	}
+	if opts.GroupLabel != "" {
+		_, _ = fmt.Fprintln(w, "")
+		_, _ = fmt.Fprintf(w, "API VERSION\tKIND\t%s\tCOUNT\t\n", strings.ToUpper(opts.GroupLabel))
+		for _, gvk := range gvks {
+			for _, kv := range sortedCounts(report.LabelGroups[gvk]) {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t\n", gvk.GroupVersion(), gvk.Kind, kv.Key, kv.Count)
+			}
+		}
+	}
+
+	if len(report.Objects) > 0 {
+		_, _ = fmt.Fprintln(w, "")
+		_, _ = fmt.Fprint(w, "KIND\tNAMESPACE\tNAME\tMODE\tREPLICAS\tSTATUS\tCPU\tMEMORY\tSTORAGE\t")
+		for _, col := range opts.Expr.Columns {
+			_, _ = fmt.Fprintf(w, "%s\t", strings.ToUpper(col.Name))
+		}
+		_, _ = fmt.Fprintln(w)
+		for _, obj := range report.Objects {
+			mode := obj.Spec.Mode
+			if mode == "" {
+				mode = "-"
+			}
+			rl := obj.Spec.AppResource.Limits
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t",
+				schema.GroupKind{Group: obj.Spec.Group, Kind: obj.Spec.Kind}, obj.Namespace, obj.Name, mode, obj.Spec.Replicas, obj.Status.Status, rl.Cpu(), rl.Memory(), rl.Storage())
+			gvk := schema.GroupVersionKind{Group: obj.Spec.Group, Version: obj.Spec.Version, Kind: obj.Spec.Kind}
+			for _, v := range report.Columns[rawObjectKey(gvk, obj.Namespace, obj.Name)] {
+				_, _ = fmt.Fprintf(w, "%s\t", v)
+			}
+			_, _ = fmt.Fprintln(w)
 		}
 	}
-	_, _ = fmt.Fprintf(w, "TOTAL\t=\t%d\t%s\t%s\t%s\t\n", totalCount, rrTotal.Cpu(), rrTotal.Memory(), rrTotal.Storage())
 	return w.Flush()
 }
 
-func ToGenericResource(item unstructured.Unstructured, gvk schema.GroupVersionKind) (*GenericResource, error) {
+// summaryNotes records the markers used in a table of summaries, so that they can be explained below it.
+type summaryNotes struct {
+	partial, incomplete, metadataOnly, noCalculator bool
+}
+
+func (n summaryNotes) Lines() []string {
+	var lines []string
+	if n.partial {
+		lines = append(lines, "* listed only in the namespaces accessible to the current user")
+	}
+	if n.incomplete {
+		lines = append(lines, "+ listing did not finish, counts and resources are partial")
+	}
+	if n.metadataOnly {
+		lines = append(lines, "resources are not calculated for kinds counted from metadata only (--count-only)")
+	}
+	if n.noCalculator {
+		lines = append(lines, "n/a: no resource calculator is registered for the kind")
+	}
+	return lines
+}
+
+// summaryCells returns the COUNT, REPLICAS, CPU, MEMORY and STORAGE cells of a type with
+// the markers for errors, missing access, partial listings and metadata only counts.
+// counted is false if the type has no counted objects, eg, because it could not be listed.
+func summaryCells(report *Report, gvk schema.GroupVersionKind, notes *summaryNotes) (cells []string, counted bool) {
+	rr := report.Summaries[gvk]
+	access, checked := report.Access[gvk]
+
+	count := strconv.Itoa(rr.Spec.Count)
+	switch {
+	case report.Incomplete[gvk]:
+		notes.incomplete = true
+		count += "+"
+	case report.Errors[gvk] != nil:
+		return []string{"error", "-", "-", "-", "-"}, false
+	case checked && !access.Allowed():
+		return []string{"no access", "-", "-", "-", "-"}, false
+	case checked && !access.ClusterWide:
+		// counted only in the namespaces the user can access
+		notes.partial = true
+		count += "*"
+	case rr.Spec.Count == 0:
+		return []string{"-", "-", "-", "-", "-"}, false
+	}
+
+	rl := rr.Spec.AppResource.Limits
+	cpu, memory, storage := rl.Cpu().String(), rl.Memory().String(), rl.Storage().String()
+	if !hasCalculator(gvk) {
+		notes.noCalculator = true
+		cpu, memory, storage = "n/a", "n/a", "n/a"
+	} else if report.MetadataOnly[gvk] {
+		notes.metadataOnly = true
+		cpu, memory, storage = "-", "-", "-"
+	}
+	replicas := strconv.FormatInt(rr.Spec.Replicas, 10)
+	if report.MetadataOnly[gvk] {
+		replicas = "-"
+	}
+	return []string{count, replicas, cpu, memory, storage}, true
+}
+
+type keyCount struct {
+	Key   string
+	Count int
+}
+
+// sortedCounts returns the entries of a count map sorted by key.
+func sortedCounts(m map[string]int) []keyCount {
+	result := make([]keyCount, 0, len(m))
+	for k, v := range m {
+		result = append(result, keyCount{Key: k, Count: v})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+func ToGenericResource(item unstructured.Unstructured, gvk schema.GroupVersionKind) (*v1alpha1.GenericResource, error) {
 	content := item.UnstructuredContent()
 
 	itemStatus, err := status.Compute(&item)
@@ -145,7 +778,7 @@ func ToGenericResource(item unstructured.Unstructured, gvk schema.GroupVersionKi
 		return nil, err
 	}
 
-	genres := GenericResource{
+	genres := v1alpha1.GenericResource{
 		// TypeMeta:   metav1.TypeMeta{},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:                       item.GetName(),
@@ -165,7 +798,7 @@ func ToGenericResource(item unstructured.Unstructured, gvk schema.GroupVersionKi
 			ClusterName:                item.GetClusterName(),
 			// ManagedFields:              nil,
 		},
-		Spec: GenericResourceSpec{
+		Spec: v1alpha1.GenericResourceSpec{
 			Group:                gvk.Group,
 			Version:              gvk.Version,
 			Kind:                 gvk.Kind,
@@ -178,7 +811,11 @@ func ToGenericResource(item unstructured.Unstructured, gvk schema.GroupVersionKi
 			RoleResourceRequests: nil,
 			// Status:               "",
 		},
-		Status: *itemStatus,
+		Status: v1alpha1.GenericResourceStatus{
+			Status:     itemStatus.Status,
+			Message:    itemStatus.Message,
+			Conditions: itemStatus.Conditions,
+		},
 	}
 
 	{
@@ -193,7 +830,12 @@ func ToGenericResource(item unstructured.Unstructured, gvk schema.GroupVersionKi
 		if err != nil {
 			return nil, err
 		}
-		genres.Spec.RoleReplicas = rv
+		if rv != nil {
+			genres.Spec.RoleReplicas = v1alpha1.ReplicaList{}
+			for role, n := range rv {
+				genres.Spec.RoleReplicas[v1alpha1.PodRole(role)] = n
+			}
+		}
 	}
 	{
 		rv, err := resourcemetrics.Mode(content)
@@ -235,14 +877,25 @@ func ToGenericResource(item unstructured.Unstructured, gvk schema.GroupVersionKi
 		if err != nil {
 			return nil, err
 		}
-		genres.Spec.RoleResourceRequests = rv
+		genres.Spec.RoleResourceRequests = toRoleResources(rv)
 	}
 	{
 		rv, err := resourcemetrics.RoleResourceLimits(content)
 		if err != nil {
 			return nil, err
 		}
-		genres.Spec.RoleResourceLimits = rv
+		genres.Spec.RoleResourceLimits = toRoleResources(rv)
 	}
 	return &genres, nil
 }
+
+func toRoleResources(in map[api.PodRole]core.ResourceList) map[v1alpha1.PodRole]core.ResourceList {
+	if in == nil {
+		return nil
+	}
+	out := make(map[v1alpha1.PodRole]core.ResourceList, len(in))
+	for role, rl := range in {
+		out[v1alpha1.PodRole(role)] = rl
+	}
+	return out
+}
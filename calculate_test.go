@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pagingClient serves List calls in pages of ListOptions.Limit objects and
+// fails them once ctx is done, since the fake client ignores both.
+type pagingClient struct {
+	client.Client
+	calls int32
+}
+
+func (c *pagingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	atomic.AddInt32(&c.calls, 1)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	var lo client.ListOptions
+	lo.ApplyOptions(opts)
+	if lo.Limit == 0 {
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	start := 0
+	if lo.Continue != "" {
+		if start, err = strconv.Atoi(lo.Continue); err != nil {
+			return err
+		}
+	}
+	end := start + int(lo.Limit)
+	cont := strconv.Itoa(end)
+	if end >= len(items) {
+		end, cont = len(items), ""
+	}
+	if err := meta.SetList(list, items[start:end]); err != nil {
+		return err
+	}
+	list.SetContinue(cont)
+	return nil
+}
+
+func newPod(ns, name, cpu, memory string) *core.Pod {
+	return &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+		Spec: core.PodSpec{Containers: []core.Container{{
+			Name: "app",
+			Resources: core.ResourceRequirements{Requests: core.ResourceList{
+				core.ResourceCPU:    resource.MustParse(cpu),
+				core.ResourceMemory: resource.MustParse(memory),
+			}},
+		}}},
+	}
+}
+
+func TestListPages(t *testing.T) {
+	var objs []runtime.Object
+	for i := 0; i < 5; i++ {
+		objs = append(objs, newPod("demo", "pod-"+strconv.Itoa(i), "100m", "64Mi"))
+	}
+	c := &pagingClient{Client: newTestClient(t, objs...)}
+
+	var names []string
+	err := listPages(context.TODO(), c, core.SchemeGroupVersion.WithKind("Pod"), "demo", 2, nil, func(item unstructured.Unstructured) error {
+		names = append(names, item.GetName())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&c.calls); len(names) != 5 || calls != 3 {
+		t.Errorf("got %d objects in %d calls, want 5 in 3", len(names), calls)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	replicas := int32(2)
+	deploy := &apps.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web"},
+		Spec: apps.DeploymentSpec{
+			Replicas: &replicas,
+			Template: core.PodTemplateSpec{Spec: newPod("", "", "250m", "128Mi").Spec},
+		},
+	}
+	c := &pagingClient{Client: newTestClient(t,
+		newPod("demo", "a", "100m", "64Mi"),
+		newPod("demo", "b", "200m", "64Mi"),
+		newPod("other", "c", "300m", "128Mi"),
+		deploy,
+	)}
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+	deployments := apps.SchemeGroupVersion.WithKind("Deployment")
+
+	report, err := collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods, deployments}, nil, CalculateOptions{Concurrency: 4, PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Incomplete) != 0 || len(report.Errors) != 0 {
+		t.Fatalf("unexpected incomplete %v or errors %v", report.Incomplete, report.Errors)
+	}
+	checkSummary(t, report, pods, 3, "600m", "256Mi")
+	checkSummary(t, report, deployments, 1, "500m", "256Mi")
+	if got := report.Namespaces[pods]; got["demo"] != 2 || got["other"] != 1 {
+		t.Errorf("namespaces = %v", got)
+	}
+}
+
+func TestCollectCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+	report, err := collect(ctx, &pagingClient{Client: newTestClient(t)}, testKubernetesInfo(), []schema.GroupVersionKind{pods}, nil, CalculateOptions{Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Incomplete[pods] {
+		t.Errorf("pods not marked incomplete: %v", report.Incomplete)
+	}
+}
+
+func checkSummary(t *testing.T, report *Report, gvk schema.GroupVersionKind, count int, cpu, memory string) {
+	t.Helper()
+	spec := report.Summaries[gvk].Spec
+	if spec.Count != count {
+		t.Errorf("%s: count = %d, want %d", gvk.Kind, spec.Count, count)
+	}
+	requests := spec.TotalResource.Requests
+	if requests.Cpu().Cmp(resource.MustParse(cpu)) != 0 || requests.Memory().Cmp(resource.MustParse(memory)) != 0 {
+		t.Errorf("%s: requests = %v, want cpu=%s memory=%s", gvk.Kind, requests, cpu, memory)
+	}
+}
+
+func TestCollectCountOnly(t *testing.T) {
+	labeled := func(pod *core.Pod, app string) *core.Pod {
+		pod.Labels = map[string]string{"app.kubernetes.io/name": app}
+		return pod
+	}
+	c := newTestClient(t,
+		labeled(newPod("demo", "a", "100m", "64Mi"), "web"),
+		labeled(newPod("demo", "b", "200m", "64Mi"), "web"),
+		newPod("other", "c", "300m", "128Mi"),
+		parseObject(t, `
+apiVersion: kubedb.com/v1alpha2
+kind: Postgres
+metadata:
+  namespace: demo
+  name: pg
+`),
+	)
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+	postgres := schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"}
+	opts := CalculateOptions{Concurrency: 1, CountOnly: true, GroupLabel: "app.kubernetes.io/name"}
+
+	report, err := collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods, postgres}, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.MetadataOnly[pods] || !report.MetadataOnly[postgres] {
+		t.Errorf("not listed with metadata only: %v", report.MetadataOnly)
+	}
+	checkSummary(t, report, pods, 3, "0", "0")
+	checkSummary(t, report, postgres, 1, "0", "0")
+	if got := report.LabelGroups[pods]; got["web"] != 2 || got[noneValue] != 1 {
+		t.Errorf("label groups = %v", got)
+	}
+
+	opts.ResourceKinds = sets.NewString("Pod")
+	report, err = collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods}, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.MetadataOnly[pods] {
+		t.Error("pods in ResourceKinds listed with metadata only")
+	}
+	checkSummary(t, report, pods, 3, "600m", "256Mi")
+}
+
+func TestSelectGVKs(t *testing.T) {
+	resources, err := apiResourceMap(testResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postgres := resources[schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"}]
+	postgres.Categories = []string{"all", "datastore"}
+	resources[schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"}] = postgres
+
+	gvks := []schema.GroupVersionKind{
+		{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"},
+		{Group: "kubedb.com", Version: "v1alpha2", Kind: "MongoDB"},
+		{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+		{Version: "v1", Kind: "Pod"},
+		{Version: "v1", Kind: "Node"},
+		// not served by the cluster, so only the group, version and kind labels are set
+		{Group: "kubedb.com", Version: "v1alpha2", Kind: "MySQL"},
+	}
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{"", []string{"Node", "Pod", "StatefulSet", "MongoDB", "MySQL", "Postgres"}},
+		{"k8s.io/group=kubedb.com", []string{"MongoDB", "MySQL", "Postgres"}},
+		{"k8s.io/group notin (kubedb.com,apps)", []string{"Node", "Pod"}},
+		{"k8s.io/kind in (Postgres,MySQL)", []string{"MySQL", "Postgres"}},
+		{"k8s.io/scope=Cluster", []string{"Node"}},
+		{"k8s.io/scope=Namespaced,k8s.io/group=kubedb.com", []string{"MongoDB", "Postgres"}},
+		{"!k8s.io/resource", []string{"MySQL"}},
+		{"category.k8s.io/datastore", []string{"Postgres"}},
+		{"k8s.io/resource=pods", []string{"Pod"}},
+	}
+	for _, tt := range tests {
+		s, err := labels.Parse(tt.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, gvk := range SelectGVKs(s, gvks, resources) {
+			got = append(got, gvk.Kind)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: got %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestCollectModes(t *testing.T) {
+	postgres := schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"}
+	pg := func(name, mode string, replicas int) runtime.Object {
+		return parseObject(t, `
+apiVersion: kubedb.com/v1alpha2
+kind: Postgres
+metadata:
+  namespace: demo
+  name: `+name+`
+spec:
+  standbyMode: "`+mode+`"
+  replicas: `+strconv.Itoa(replicas)+`
+  podTemplate:
+    spec:
+      resources:
+        requests:
+          cpu: 500m
+          memory: 1Gi
+`)
+	}
+	c := newTestClient(t, pg("a", "", 1), pg("b", "Hot", 3), pg("c", "Hot", 2), newPod("demo", "web", "100m", "64Mi"))
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+
+	report, err := collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{postgres, pods}, nil, CalculateOptions{Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := report.Summaries[postgres].Spec
+	if spec.Count != 3 || spec.Replicas != 6 {
+		t.Errorf("count = %d, replicas = %d, want 3 and 6", spec.Count, spec.Replicas)
+	}
+	if len(spec.Modes) != 2 {
+		t.Fatalf("modes = %+v", spec.Modes)
+	}
+	hot, standalone := spec.Modes[0], spec.Modes[1]
+	if hot.Mode != "Hot" || hot.Count != 2 || hot.Replicas != 5 || hot.TotalResource.Requests.Cpu().Cmp(resource.MustParse("2500m")) != 0 {
+		t.Errorf("hot = %+v", hot)
+	}
+	if standalone.Mode != "Standalone" || standalone.Count != 1 || standalone.Replicas != 1 {
+		t.Errorf("standalone = %+v", standalone)
+	}
+	// kinds without modes are not broken down
+	if modes := report.Summaries[pods].Spec.Modes; len(modes) != 0 {
+		t.Errorf("pod modes = %+v", modes)
+	}
+}
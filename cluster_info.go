@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CheckStatus is the outcome of a cluster-info check. The numeric value is
+// used as the process exit code, so that the report can drive cron or CI alerts.
+type CheckStatus int
+
+const (
+	CheckOK CheckStatus = iota
+	CheckWarning
+	CheckCritical
+)
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckOK:
+		return "OK"
+	case CheckWarning:
+		return "WARNING"
+	default:
+		return "CRITICAL"
+	}
+}
+
+type ClusterCheck struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+}
+
+type ClusterInfoOptions struct {
+	// certificates expiring within these durations are flagged
+	CertWarning  time.Duration
+	CertCritical time.Duration
+	// maximum number of minor versions a kubelet may be older than the API server
+	MaxKubeletSkew int
+	// maximum number of NotReady nodes reported as a warning, more are critical
+	MaxNotReady int
+}
+
+func checkCertificate(ki *v1alpha1.KubernetesInfo, opts ClusterInfoOptions, now time.Time) ClusterCheck {
+	check := ClusterCheck{Name: "api server certificate"}
+	if ki.ControlPlane == nil {
+		check.Status = CheckWarning
+		check.Message = "certificate not available"
+		return check
+	}
+
+	notAfter := ki.ControlPlane.NotAfter.Time
+	remaining := notAfter.Sub(now)
+	switch {
+	case now.Before(ki.ControlPlane.NotBefore.Time):
+		check.Status = CheckCritical
+		check.Message = fmt.Sprintf("not valid before %s", ki.ControlPlane.NotBefore.UTC().Format(time.RFC3339))
+		return check
+	case remaining <= 0:
+		check.Status = CheckCritical
+		check.Message = fmt.Sprintf("expired on %s", notAfter.UTC().Format(time.RFC3339))
+		return check
+	case remaining <= opts.CertCritical:
+		check.Status = CheckCritical
+	case remaining <= opts.CertWarning:
+		check.Status = CheckWarning
+	}
+	check.Message = fmt.Sprintf("expires on %s (in %d days)", notAfter.UTC().Format(time.RFC3339), int(remaining.Hours()/24))
+	return check
+}
+
+func kubeletSkew(server *version.Version, node core.Node, maxSkew int) (CheckStatus, string) {
+	kv, err := version.ParseGeneric(node.Status.NodeInfo.KubeletVersion)
+	if err != nil {
+		return CheckWarning, fmt.Sprintf("unknown kubelet version %q", node.Status.NodeInfo.KubeletVersion)
+	}
+	if kv.Major() != server.Major() {
+		return CheckCritical, "major version mismatch"
+	}
+	skew := int(server.Minor()) - int(kv.Minor())
+	switch {
+	case skew < 0:
+		return CheckCritical, fmt.Sprintf("%d minor version(s) newer than api server", -skew)
+	case skew > maxSkew:
+		return CheckCritical, fmt.Sprintf("%d minor version(s) older than api server", skew)
+	}
+	return CheckOK, ""
+}
+
+func isNodeReady(node core.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == core.NodeReady {
+			return cond.Status == core.ConditionTrue
+		}
+	}
+	return false
+}
+
+// readinessStatus warns about any NotReady node and is critical above the tolerated number.
+func readinessStatus(notReady, maxNotReady int) CheckStatus {
+	switch {
+	case notReady > maxNotReady:
+		return CheckCritical
+	case notReady > 0:
+		return CheckWarning
+	}
+	return CheckOK
+}
+
+func clusterInfo(ctx context.Context, out io.Writer, c client.Client, ki *v1alpha1.KubernetesInfo, r *Redactor, opts ClusterInfoOptions) (CheckStatus, error) {
+	var nodes core.NodeList
+	nodesErr := c.List(ctx, &nodes)
+	if nodesErr != nil && !kerr.IsForbidden(nodesErr) {
+		return CheckCritical, nodesErr
+	}
+
+	checks := []ClusterCheck{checkCertificate(ki, opts, time.Now())}
+
+	skewCheck := ClusterCheck{Name: "kubelet version skew"}
+	serverVersion, err := version.ParseGeneric(ki.Version.GitVersion)
+	if err != nil {
+		return CheckCritical, err
+	}
+	var skewed int
+	nodeSkew := make([]string, len(nodes.Items))
+	for i, node := range nodes.Items {
+		status, msg := kubeletSkew(serverVersion, node, opts.MaxKubeletSkew)
+		if status > skewCheck.Status {
+			skewCheck.Status = status
+		}
+		if status != CheckOK {
+			skewed++
+			nodeSkew[i] = msg
+		}
+	}
+	skewCheck.Message = fmt.Sprintf("%d/%d nodes outside supported skew of %s", skewed, len(nodes.Items), ki.Version.GitVersion)
+	if nodesErr != nil {
+		skewCheck.Status = CheckWarning
+		skewCheck.Message = "no access to list nodes"
+	}
+	checks = append(checks, skewCheck)
+
+	readyCheck := ClusterCheck{Name: "node readiness"}
+	var notReady int
+	for _, node := range nodes.Items {
+		if !isNodeReady(node) {
+			notReady++
+		}
+	}
+	readyCheck.Status = readinessStatus(notReady, opts.MaxNotReady)
+	readyCheck.Message = fmt.Sprintf("%d/%d nodes NotReady", notReady, len(nodes.Items))
+	if nodesErr != nil {
+		readyCheck.Status = CheckWarning
+		readyCheck.Message = "no access to list nodes"
+	}
+	checks = append(checks, readyCheck)
+
+	const padding = 3
+	w := tabwriter.NewWriter(out, 0, 0, padding, ' ', tabwriter.TabIndent)
+	_, _ = fmt.Fprintf(w, "CLUSTER NAME:\t%s\n", r.Hash(ki.ClusterName))
+	_, _ = fmt.Fprintf(w, "CLUSTER ID:\t%s\n", r.Hash(ki.ClusterUID))
+	_, _ = fmt.Fprintf(w, "VERSION:\t%s\n", ki.Version.GitVersion)
+	provider := ki.Provider
+	if provider == "" {
+		provider = "unknown"
+	}
+	_, _ = fmt.Fprintf(w, "PROVIDER:\t%s\n", provider)
+	if inv := ki.Nodes; inv != nil {
+		_, _ = fmt.Fprintf(w, "NODES:\t%d\n", inv.Count)
+		_, _ = fmt.Fprintf(w, "  ROLES:\t%s\n", FormatCounts(inv.Roles))
+		_, _ = fmt.Fprintf(w, "  OS:\t%s\n", FormatCounts(inv.OperatingSystems))
+		_, _ = fmt.Fprintf(w, "  ARCH:\t%s\n", FormatCounts(inv.Architectures))
+		_, _ = fmt.Fprintf(w, "  INSTANCE TYPES:\t%s\n", FormatCounts(inv.InstanceTypes))
+		_, _ = fmt.Fprintf(w, "  ZONES:\t%s\n", FormatCounts(inv.Zones))
+		_, _ = fmt.Fprintf(w, "  KUBELET:\t%s\n", FormatCounts(inv.KubeletVersions))
+		_, _ = fmt.Fprintf(w, "  CONTAINER RUNTIME:\t%s\n", FormatCounts(inv.ContainerRuntimeVersions))
+	}
+	scNames := make([]string, 0, len(ki.StorageClasses))
+	for _, sc := range ki.StorageClasses {
+		name := sc.Name + "(" + sc.Provisioner + ")"
+		if sc.IsDefault {
+			name += "*"
+		}
+		scNames = append(scNames, name)
+	}
+	_, _ = fmt.Fprintf(w, "STORAGE CLASSES:\t%s\n", strings.Join(scNames, ", "))
+	_, _ = fmt.Fprintf(w, "CSI DRIVERS:\t%s\n", strings.Join(ki.CSIDrivers, ", "))
+	_, _ = fmt.Fprintln(w, "")
+
+	result := CheckOK
+	_, _ = fmt.Fprintln(w, "CHECK\tSTATUS\tMESSAGE\t")
+	for _, check := range checks {
+		if check.Status > result {
+			result = check.Status
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t\n", check.Name, check.Status, check.Message)
+	}
+	_, _ = fmt.Fprintln(w, "")
+
+	_, _ = fmt.Fprintln(w, "NODE\tREADY\tKUBELET\tSKEW\t")
+	for i, node := range nodes.Items {
+		skew := nodeSkew[i]
+		if skew == "" {
+			skew = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%t\t%s\t%s\t\n", r.Hash(node.Name), isNodeReady(node), node.Status.NodeInfo.KubeletVersion, skew)
+	}
+	return result, w.Flush()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+func TestReadinessStatus(t *testing.T) {
+	tests := []struct {
+		notReady, maxNotReady int
+		want                  CheckStatus
+	}{
+		{0, 0, CheckOK},
+		{0, 1, CheckOK},
+		{1, 1, CheckWarning},
+		{2, 1, CheckCritical},
+		{1, 0, CheckCritical},
+		{3, 5, CheckWarning},
+	}
+	for _, tt := range tests {
+		if got := readinessStatus(tt.notReady, tt.maxNotReady); got != tt.want {
+			t.Errorf("readinessStatus(%d, %d) = %s, want %s", tt.notReady, tt.maxNotReady, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	opts := ClusterInfoOptions{CertWarning: 30 * 24 * time.Hour, CertCritical: 7 * 24 * time.Hour}
+	cert := func(notBefore, notAfter time.Time) *v1alpha1.KubernetesInfo {
+		return &v1alpha1.KubernetesInfo{ControlPlane: &v1alpha1.ControlPlaneInfo{
+			NotBefore: metav1.NewTime(notBefore),
+			NotAfter:  metav1.NewTime(notAfter),
+		}}
+	}
+	day := 24 * time.Hour
+	tests := []struct {
+		name string
+		ki   *v1alpha1.KubernetesInfo
+		want CheckStatus
+	}{
+		{"missing", &v1alpha1.KubernetesInfo{}, CheckWarning},
+		{"valid", cert(now.Add(-day), now.Add(90*day)), CheckOK},
+		{"expires soon", cert(now.Add(-day), now.Add(20*day)), CheckWarning},
+		{"expires very soon", cert(now.Add(-day), now.Add(3*day)), CheckCritical},
+		{"expired", cert(now.Add(-90*day), now.Add(-day)), CheckCritical},
+		{"not yet valid", cert(now.Add(day), now.Add(90*day)), CheckCritical},
+	}
+	for _, tt := range tests {
+		if got := checkCertificate(tt.ki, opts, now); got.Status != tt.want {
+			t.Errorf("%s: got %s (%s), want %s", tt.name, got.Status, got.Message, tt.want)
+		}
+	}
+}
+
+func TestKubeletSkew(t *testing.T) {
+	server := version.MustParseGeneric("v1.21.1")
+	tests := []struct {
+		kubelet string
+		want    CheckStatus
+	}{
+		{"v1.21.1", CheckOK},
+		{"v1.19.3", CheckOK},
+		{"v1.18.0", CheckCritical},
+		{"v1.22.0", CheckCritical},
+		{"v2.21.0", CheckCritical},
+		{"unknown", CheckWarning},
+	}
+	for _, tt := range tests {
+		node := core.Node{Status: core.NodeStatus{NodeInfo: core.NodeSystemInfo{KubeletVersion: tt.kubelet}}}
+		if got, msg := kubeletSkew(server, node, 2); got != tt.want {
+			t.Errorf("kubelet %s: got %s (%s), want %s", tt.kubelet, got, msg, tt.want)
+		}
+	}
+}
+
+func newNode(name, kubelet string, ready bool) *core.Node {
+	status := core.ConditionFalse
+	if ready {
+		status = core.ConditionTrue
+	}
+	return &core.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: core.NodeStatus{
+			NodeInfo:   core.NodeSystemInfo{KubeletVersion: kubelet},
+			Conditions: []core.NodeCondition{{Type: core.NodeReady, Status: status}},
+		},
+	}
+}
+
+func TestClusterInfo(t *testing.T) {
+	ki := testKubernetesInfo()
+	ki.ControlPlane = &v1alpha1.ControlPlaneInfo{
+		NotBefore: metav1.NewTime(time.Now().Add(-time.Hour)),
+		NotAfter:  metav1.NewTime(time.Now().Add(365 * 24 * time.Hour)),
+	}
+	opts := ClusterInfoOptions{CertWarning: 30 * 24 * time.Hour, CertCritical: 7 * 24 * time.Hour, MaxKubeletSkew: 2, MaxNotReady: 1}
+
+	tests := []struct {
+		name  string
+		nodes []*core.Node
+		want  CheckStatus
+	}{
+		{"healthy", []*core.Node{newNode("a", "v1.21.1", true), newNode("b", "v1.20.0", true)}, CheckOK},
+		{"one not ready", []*core.Node{newNode("a", "v1.21.1", true), newNode("b", "v1.21.1", false)}, CheckWarning},
+		{"two not ready", []*core.Node{newNode("a", "v1.21.1", false), newNode("b", "v1.21.1", false)}, CheckCritical},
+		{"skewed kubelet", []*core.Node{newNode("a", "v1.17.0", true)}, CheckCritical},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := make([]runtime.Object, 0, len(tt.nodes))
+			for _, n := range tt.nodes {
+				objs = append(objs, n)
+			}
+			var buf bytes.Buffer
+			got, err := clusterInfo(context.TODO(), &buf, newTestClient(t, objs...), ki, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s\n%s", got, tt.want, buf.String())
+			}
+			if !strings.Contains(buf.String(), "node readiness") {
+				t.Errorf("readiness check missing:\n%s", buf.String())
+			}
+		})
+	}
+}
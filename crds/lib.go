@@ -0,0 +1,37 @@
+// Package crds embeds the CustomResourceDefinitions of the reports.appscode.com API group.
+package crds
+
+import (
+	"embed"
+	"fmt"
+
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kmodules.xyz/client-go/apiextensions"
+	"sigs.k8s.io/yaml"
+)
+
+//go:embed *.yaml
+var fs embed.FS
+
+// CustomResourceDefinition returns the CRD of the given group and resource, eg, reports.appscode.com/resourcesummaries.
+func CustomResourceDefinition(gvr schema.GroupVersionResource) (*apiextensions.CustomResourceDefinition, error) {
+	data, err := fs.ReadFile(fmt.Sprintf("%s_%s.yaml", gvr.Group, gvr.Resource))
+	if err != nil {
+		return nil, err
+	}
+	var out crdv1.CustomResourceDefinition
+	if err := yaml.UnmarshalStrict(data, &out); err != nil {
+		return nil, err
+	}
+	return &apiextensions.CustomResourceDefinition{V1: &out}, nil
+}
+
+// MustCustomResourceDefinition is like CustomResourceDefinition, but panics if the CRD is not embedded.
+func MustCustomResourceDefinition(gvr schema.GroupVersionResource) *apiextensions.CustomResourceDefinition {
+	out, err := CustomResourceDefinition(gvr)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kmodules.xyz/resource-metrics/api"
+)
+
+// ResourceField is a resources block found in the spec of an object, eg, of a container.
+type ResourceField struct {
+	Path      string
+	Resources core.ResourceRequirements
+}
+
+// ClaimTemplate is a volume claim template found in the spec of an object.
+type ClaimTemplate struct {
+	Path         string
+	StorageClass string
+	Size         resource.Quantity
+}
+
+// RoleContribution is the part of the limits or requests of an object that comes from one pod role.
+type RoleContribution struct {
+	Role api.PodRole
+	// App and Runtime report whether the role is summed into the App and Total resources.
+	// Init roles are compared with the sum of the runtime roles, since init containers
+	// finish before the others start.
+	App     bool
+	Runtime bool
+	Init    bool
+	// Replicas is the number of pods the role is multiplied by. Roles without their own
+	// replica count (eg, exporter and init) run in every pod of the app roles.
+	Replicas   int64
+	PerReplica core.ResourceList
+	Resources  core.ResourceList
+}
+
+// Explanation shows how the numbers of one object are computed by its resource calculator.
+type Explanation struct {
+	GVK          schema.GroupVersionKind
+	Namespace    string
+	Name         string
+	Mode         string
+	Replicas     int64
+	RoleReplicas api.ReplicaList
+	AppRoles     []api.PodRole
+	RuntimeRoles []api.PodRole
+
+	Fields    []ResourceField
+	Templates []ClaimTemplate
+
+	Limits        []RoleContribution
+	Requests      []RoleContribution
+	AppLimits     core.ResourceList
+	AppRequests   core.ResourceList
+	TotalLimits   core.ResourceList
+	TotalRequests core.ResourceList
+}
+
+// Explain breaks the resources of an object down by pod role and lists the fields they are read from.
+func Explain(item unstructured.Unstructured) (*Explanation, error) {
+	content := item.UnstructuredContent()
+	calc, err := api.Load(content)
+	if err != nil {
+		return nil, err
+	}
+
+	e := Explanation{
+		GVK:       item.GroupVersionKind(),
+		Namespace: item.GetNamespace(),
+		Name:      item.GetName(),
+	}
+	if funcs, ok := calc.(*api.ResourceCalculatorFuncs); ok {
+		e.AppRoles = funcs.AppRoles
+		e.RuntimeRoles = funcs.RuntimeRoles
+	}
+	if e.Mode, err = calc.Mode(content); err != nil {
+		return nil, err
+	}
+	if e.Replicas, err = calc.Replicas(content); err != nil {
+		return nil, err
+	}
+	if e.RoleReplicas, err = calc.RoleReplicas(content); err != nil {
+		return nil, err
+	}
+	limits, err := calc.RoleResourceLimits(content)
+	if err != nil {
+		return nil, err
+	}
+	requests, err := calc.RoleResourceRequests(content)
+	if err != nil {
+		return nil, err
+	}
+	e.Limits = e.roleContributions(limits)
+	e.Requests = e.roleContributions(requests)
+	if e.AppLimits, err = calc.AppResourceLimits(content); err != nil {
+		return nil, err
+	}
+	if e.AppRequests, err = calc.AppResourceRequests(content); err != nil {
+		return nil, err
+	}
+	if e.TotalLimits, err = calc.TotalResourceLimits(content); err != nil {
+		return nil, err
+	}
+	if e.TotalRequests, err = calc.TotalResourceRequests(content); err != nil {
+		return nil, err
+	}
+
+	if spec, ok := content["spec"]; ok {
+		e.Fields, e.Templates = findResourceFields("spec", spec, nil, nil)
+	}
+	return &e, nil
+}
+
+// resolveKind finds the type with a resource calculator named by the kind, resource or short name,
+// optionally followed by the group, eg, postgres, pg or postgreses.kubedb.com.
+func resolveKind(arg string, resources map[schema.GroupVersionKind]metav1.APIResource) (schema.GroupVersionKind, metav1.APIResource, error) {
+	arg = strings.ToLower(arg)
+	var matches []schema.GroupVersionKind
+	for _, gvk := range api.RegisteredTypes() {
+		res, found := resources[gvk]
+		if !found {
+			continue
+		}
+		names := append([]string{strings.ToLower(gvk.Kind), res.Name, res.SingularName}, res.ShortNames...)
+		for _, name := range names {
+			if name != "" && (arg == name || arg == name+"."+gvk.Group) {
+				matches = append(matches, gvk)
+				break
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return schema.GroupVersionKind{}, metav1.APIResource{}, fmt.Errorf("no served type with a resource calculator matches %q", arg)
+	case 1:
+		return matches[0], resources[matches[0]], nil
+	}
+	names := make([]string, 0, len(matches))
+	for _, gvk := range matches {
+		names = append(names, gvk.String())
+	}
+	sort.Strings(names)
+	return schema.GroupVersionKind{}, metav1.APIResource{}, fmt.Errorf("%q is ambiguous, qualify it with the group of one of %s", arg, strings.Join(names, ", "))
+}
+
+func hasRole(roles []api.PodRole, role api.PodRole) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// roleContributions orders the roles as app roles, other runtime roles, init and the rest.
+func (e *Explanation) roleContributions(rr map[api.PodRole]core.ResourceList) []RoleContribution {
+	rank := func(role api.PodRole) int {
+		switch {
+		case hasRole(e.AppRoles, role):
+			return 0
+		case hasRole(e.RuntimeRoles, role):
+			return 1
+		case role == api.PodRoleInit:
+			return 2
+		}
+		return 3
+	}
+
+	out := make([]RoleContribution, 0, len(rr))
+	for role, rl := range rr {
+		rc := RoleContribution{
+			Role:      role,
+			App:       hasRole(e.AppRoles, role),
+			Runtime:   hasRole(e.RuntimeRoles, role),
+			Init:      role == api.PodRoleInit,
+			Resources: rl,
+		}
+		if n, ok := e.RoleReplicas[role]; ok {
+			rc.Replicas = n
+		} else {
+			rc.Replicas = e.Replicas
+		}
+		if rc.Replicas > 0 {
+			rc.PerReplica = divResourceList(rl, rc.Replicas)
+		}
+		out = append(out, rc)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if ri, rj := rank(out[i].Role), rank(out[j].Role); ri != rj {
+			return ri < rj
+		}
+		return out[i].Role < out[j].Role
+	})
+	return out
+}
+
+// divResourceList is the inverse of api.MulResourceList. cpu is divided in millicores,
+// every other resource in whole units, eg, bytes, so memory is not printed in millibytes.
+func divResourceList(x core.ResourceList, divisor int64) core.ResourceList {
+	result := core.ResourceList{}
+	for name, q := range x {
+		if name == core.ResourceCPU {
+			result[name] = *resource.NewMilliQuantity(q.MilliValue()/divisor, q.Format)
+		} else {
+			result[name] = *resource.NewQuantity(q.Value()/divisor, q.Format)
+		}
+	}
+	return result
+}
+
+// findResourceFields walks the spec for resources blocks and volume claim templates, eg,
+// spec.template.spec.containers[name=db].resources, spec.storage and spec.volumeClaimTemplates[name=data].
+func findResourceFields(path string, v interface{}, fields []ResourceField, templates []ClaimTemplate) ([]ResourceField, []ClaimTemplate) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "." + k
+			switch m, isMap := val[k].(map[string]interface{}); {
+			case k == "resources" && isMap && (m["limits"] != nil || m["requests"] != nil):
+				var rr core.ResourceRequirements
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &rr); err == nil {
+					fields = append(fields, ResourceField{Path: child, Resources: rr})
+				}
+			case k == "storage" && isMap && m["resources"] != nil:
+				templates = appendClaimTemplate(templates, child, m)
+			case k == "volumeClaimTemplates":
+				items, _ := val[k].([]interface{})
+				for i, item := range items {
+					claim, ok := item.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					spec, _, _ := unstructured.NestedMap(claim, "spec")
+					templates = appendClaimTemplate(templates, child+"["+itemName(claim, i)+"]", spec)
+				}
+			default:
+				fields, templates = findResourceFields(child, val[k], fields, templates)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			m, _ := item.(map[string]interface{})
+			fields, templates = findResourceFields(path+"["+itemName(m, i)+"]", item, fields, templates)
+		}
+	}
+	return fields, templates
+}
+
+// itemName identifies a list item by name, as in containers[name=db], or by its index.
+func itemName(item map[string]interface{}, i int) string {
+	if name, _, _ := unstructured.NestedString(item, "name"); name != "" {
+		return "name=" + name
+	}
+	if name, _, _ := unstructured.NestedString(item, "metadata", "name"); name != "" {
+		return "name=" + name
+	}
+	return strconv.Itoa(i)
+}
+
+func appendClaimTemplate(templates []ClaimTemplate, path string, spec map[string]interface{}) []ClaimTemplate {
+	var pvc core.PersistentVolumeClaimSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &pvc); err != nil {
+		return templates
+	}
+	t := ClaimTemplate{Path: path, Size: *pvc.Resources.Requests.Storage()}
+	if pvc.StorageClassName != nil {
+		t.StorageClass = *pvc.StorageClassName
+	}
+	return append(templates, t)
+}
+
+func formatResourceList(rl core.ResourceList) string {
+	if len(rl) == 0 {
+		return noneValue
+	}
+	names := []core.ResourceName{core.ResourceCPU, core.ResourceMemory, core.ResourceStorage}
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if q, ok := rl[name]; ok && !q.IsZero() {
+			parts = append(parts, fmt.Sprintf("%s=%s", name, q.String()))
+		}
+	}
+	if len(parts) == 0 {
+		return noneValue
+	}
+	return strings.Join(parts, " ")
+}
+
+func roleName(role api.PodRole) string {
+	if role == api.PodRoleDefault {
+		return "default"
+	}
+	return string(role)
+}
+
+// countedIn tells where a role is summed, sidecars like the exporter are only part of Total.
+func (rc RoleContribution) countedIn() string {
+	switch {
+	case rc.App && rc.Runtime:
+		return "app+total"
+	case rc.Runtime:
+		return "total"
+	case rc.Init:
+		return "total (max)"
+	}
+	return "-"
+}
+
+// formula returns the expression used by the resource calculator, eg, max(default + exporter, init).
+func formula(roles []RoleContribution, app bool) string {
+	var sum []string
+	init := false
+	for _, rc := range roles {
+		if (app && rc.App) || (!app && rc.Runtime) {
+			sum = append(sum, roleName(rc.Role))
+		}
+		init = init || rc.Init
+	}
+	expr := strings.Join(sum, " + ")
+	if expr == "" {
+		expr = "0"
+	}
+	if !app && init {
+		expr = fmt.Sprintf("max(%s, %s)", expr, roleName(api.PodRoleInit))
+	}
+	return expr
+}
+
+// printExplanation prints the breakdown of an object as a tree.
+func printExplanation(out io.Writer, e *Explanation) error {
+	const padding = 3
+	w := tabwriter.NewWriter(out, 0, 0, padding, ' ', tabwriter.TabIndent)
+
+	name := e.Name
+	if e.Namespace != "" {
+		name = e.Namespace + "/" + e.Name
+	}
+	_, _ = fmt.Fprintf(w, "%s %s (%s)\n", e.GVK.Kind, name, e.GVK.GroupVersion())
+	if e.Mode != "" {
+		_, _ = fmt.Fprintf(w, "├─ mode: %s\n", e.Mode)
+	}
+
+	appReplicas := make([]string, 0, len(e.AppRoles))
+	for _, role := range e.AppRoles {
+		if n, ok := e.RoleReplicas[role]; ok {
+			appReplicas = append(appReplicas, fmt.Sprintf("%s=%d", roleName(role), n))
+		}
+	}
+	_, _ = fmt.Fprintf(w, "├─ replicas: %d (sum of app roles: %s)\n", e.Replicas, strings.Join(appReplicas, ", "))
+	roles := make([]string, 0, len(e.RoleReplicas))
+	for role := range e.RoleReplicas {
+		roles = append(roles, string(role))
+	}
+	sort.Strings(roles)
+	for i, role := range roles {
+		_, _ = fmt.Fprintf(w, "│  %s %s\t%d\t\n", branch(i, len(roles)), roleName(api.PodRole(role)), e.RoleReplicas[api.PodRole(role)])
+	}
+
+	_, _ = fmt.Fprintln(w, "├─ resource fields")
+	if len(e.Fields) == 0 {
+		_, _ = fmt.Fprintf(w, "│  └─ %s\n", noneValue)
+	}
+	for i, f := range e.Fields {
+		_, _ = fmt.Fprintf(w, "│  %s %s\tlimits: %s\trequests: %s\t\n", branch(i, len(e.Fields)), f.Path, formatResourceList(f.Resources.Limits), formatResourceList(f.Resources.Requests))
+	}
+
+	if len(e.Templates) > 0 && e.TotalRequests.Storage().IsZero() {
+		_, _ = fmt.Fprintf(w, "├─ volume claim templates (not counted, the %s calculator reads no storage)\n", e.GVK.Kind)
+	} else {
+		_, _ = fmt.Fprintln(w, "├─ volume claim templates")
+	}
+	if len(e.Templates) == 0 {
+		_, _ = fmt.Fprintf(w, "│  └─ %s\n", noneValue)
+	}
+	for i, t := range e.Templates {
+		class := t.StorageClass
+		if class == "" {
+			class = "<default>"
+		}
+		_, _ = fmt.Fprintf(w, "│  %s %s\t%s\tstorage class: %s\t\n", branch(i, len(e.Templates)), t.Path, t.Size.String(), class)
+	}
+
+	printRoles(w, "├─", "│ ", "limits", e.Limits, e.AppLimits, e.TotalLimits)
+	printRoles(w, "└─", "  ", "requests", e.Requests, e.AppRequests, e.TotalRequests)
+	return w.Flush()
+}
+
+func printRoles(w io.Writer, head, indent, title string, roles []RoleContribution, app, total core.ResourceList) {
+	_, _ = fmt.Fprintf(w, "%s %s by role\n", head, title)
+	for _, rc := range roles {
+		perReplica := noneValue
+		if rc.PerReplica != nil {
+			perReplica = formatResourceList(rc.PerReplica)
+		}
+		_, _ = fmt.Fprintf(w, "%s ├─ %s\t%s\t%d x (%s)\t= %s\t\n", indent, roleName(rc.Role), rc.countedIn(), rc.Replicas, perReplica, formatResourceList(rc.Resources))
+	}
+	_, _ = fmt.Fprintf(w, "%s ├─ app\t%s\t\t= %s\t\n", indent, formula(roles, true), formatResourceList(app))
+	_, _ = fmt.Fprintf(w, "%s └─ total\t%s\t\t= %s\t\n", indent, formula(roles, false), formatResourceList(total))
+}
+
+func branch(i, n int) string {
+	if i == n-1 {
+		return "└─"
+	}
+	return "├─"
+}
+
+// printContributions prints the part of the kind row of the summary each object is responsible for.
+// The kind row shows the app resource limits, so do the columns here.
+func printContributions(out io.Writer, gvk schema.GroupVersionKind, objects []v1alpha1.GenericResource, target metav1.Object) error {
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Namespace != objects[j].Namespace {
+			return objects[i].Namespace < objects[j].Namespace
+		}
+		return objects[i].Name < objects[j].Name
+	})
+
+	total := core.ResourceList{}
+	var replicas int64
+	for _, obj := range objects {
+		total = api.AddResourceList(total, obj.Spec.AppResource.Limits)
+		replicas += obj.Spec.Replicas
+	}
+	share := func(q, sum *resource.Quantity) string {
+		if sum.IsZero() {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", float64(q.MilliValue())*100/float64(sum.MilliValue()))
+	}
+
+	const padding = 3
+	w := tabwriter.NewWriter(out, 0, 0, padding, ' ', tabwriter.TabIndent)
+	_, _ = fmt.Fprintf(w, "CONTRIBUTION TO %s (%s)\n", gvk.Kind, gvk.GroupVersion())
+	_, _ = fmt.Fprintln(w, "NAMESPACE\tNAME\tMODE\tREPLICAS\tCPU\tMEMORY\tSTORAGE\tCPU %\tMEMORY %\tSTORAGE %\t")
+	for _, obj := range objects {
+		ns, name := obj.Namespace, obj.Name
+		if ns == "" {
+			ns = "-"
+		}
+		if target != nil && obj.Namespace == target.GetNamespace() && obj.Name == target.GetName() {
+			name += " *"
+		}
+		rl := obj.Spec.AppResource.Limits
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n", ns, name, obj.Spec.Mode, obj.Spec.Replicas,
+			rl.Cpu(), rl.Memory(), rl.Storage(), share(rl.Cpu(), total.Cpu()), share(rl.Memory(), total.Memory()), share(rl.Storage(), total.Storage()))
+	}
+	_, _ = fmt.Fprintf(w, "TOTAL\t=\t\t%d\t%s\t%s\t%s\t\t\t\t\n", replicas, total.Cpu(), total.Memory(), total.Storage())
+	if target != nil {
+		_, _ = fmt.Fprintln(w, "*: the explained object")
+	}
+	return w.Flush()
+}
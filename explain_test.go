@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDivResourceList(t *testing.T) {
+	got := divResourceList(core.ResourceList{
+		core.ResourceCPU:     resource.MustParse("1"),
+		core.ResourceMemory:  resource.MustParse("3Gi"),
+		core.ResourceStorage: resource.MustParse("10G"),
+	}, 3)
+	want := map[core.ResourceName]string{
+		core.ResourceCPU:     "333m",
+		core.ResourceMemory:  "1Gi",
+		core.ResourceStorage: "3333333333",
+	}
+	for name, w := range want {
+		if q := got[name]; q.String() != w {
+			t.Errorf("%s = %s, want %s", name, q.String(), w)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	// decode the numbers as int64, like the objects read from the API server
+	data, err := newPostgres(t, "demo", "pg", "500m").(*unstructured.Unstructured).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj unstructured.Unstructured
+	if err := obj.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	e, err := Explain(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Replicas != 1 || len(e.Requests) == 0 {
+		t.Fatalf("got %+v", e)
+	}
+	if q := e.AppRequests[core.ResourceCPU]; q.String() != "500m" {
+		t.Errorf("app cpu = %s", q.String())
+	}
+}
+
+func TestReplayExplain(t *testing.T) {
+	err := replay(t, "explain", "Postgres/pg-a")
+	if err == nil || err.Error() != "--namespace is required to explain Postgres pg-a with --from-archive" {
+		t.Errorf("got %v", err)
+	}
+	if err := replay(t, "explain", "-n", "demo", "Postgres/pg-a"); err != nil {
+		t.Error(err)
+	}
+	err = replay(t, "explain", "-n", "prod", "Postgres/pg-a")
+	if !kerr.IsNotFound(err) {
+		t.Errorf("got %v", err)
+	}
+}
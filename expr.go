@@ -0,0 +1,655 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	resourcemetrics "kmodules.xyz/resource-metrics"
+)
+
+// Expression is a boolean or value expression evaluated against a single object, eg,
+//
+//	resource_replicas(self) > 3 && app_resource_limits(self, "memory") > 8Gi
+//
+// The object is available as self and its fields with dotted paths, eg, self.metadata.name.
+// Missing fields are nil. Comparisons and arithmetic with nil are nil, and nil is false
+// in boolean operators, so objects without a field do not match instead of failing the listing.
+// Only a comparison with the nil literal, eg, self.spec.paused == nil, tests whether a field is missing.
+// Functions are the resource-metrics EvalFuncs. Quantities like 500m or 8Gi are converted
+// to numbers the same way those functions convert resources: cpu in cores, everything else in units.
+type Expression struct {
+	src  string
+	root exprNode
+	// calls is true if the expression calls a resource function
+	calls bool
+}
+
+func ParseExpression(s string) (*Expression, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", s, err)
+	}
+	p := exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", s, err)
+	}
+	return &Expression{src: s, root: root, calls: p.calls}, nil
+}
+
+func (e *Expression) String() string {
+	return e.src
+}
+
+// CallsFunctions reports whether the expression needs an object with a resource calculator.
+func (e *Expression) CallsFunctions() bool {
+	return e.calls
+}
+
+func (e *Expression) Eval(self map[string]interface{}) (interface{}, error) {
+	v, err := e.root.eval(self)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %q: %w", e.src, err)
+	}
+	return v, nil
+}
+
+// Match evaluates a boolean expression. A nil result, eg, from a missing field, does not match.
+func (e *Expression) Match(self map[string]interface{}) (bool, error) {
+	v, err := e.Eval(self)
+	if err != nil || v == nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q returned %v, not a boolean", e.src, v)
+	}
+	return b, nil
+}
+
+// FormatValue prints an expression result for a table cell.
+func FormatValue(v interface{}) string {
+	switch u := v.(type) {
+	case nil:
+		return noneValue
+	case float64:
+		return strconv.FormatFloat(u, 'f', -1, 64)
+	default:
+		return fmt.Sprint(u)
+	}
+}
+
+// Column is a computed column of the per object table, set with --column name=expr.
+type Column struct {
+	Name string
+	Expr *Expression
+}
+
+type columnList []Column
+
+func (l *columnList) String() string {
+	parts := make([]string, 0, len(*l))
+	for _, c := range *l {
+		parts = append(parts, c.Name+"="+c.Expr.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l columnList) Names() []string {
+	names := make([]string, 0, len(l))
+	for _, c := range l {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Set does not split on commas, since expressions use them for function arguments.
+func (l *columnList) Set(v string) error {
+	parts := strings.SplitN(v, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("column %q must be of the form name=expr", v)
+	}
+	e, err := ParseExpression(parts[1])
+	if err != nil {
+		return err
+	}
+	*l = append(*l, Column{Name: strings.TrimSpace(parts[0]), Expr: e})
+	return nil
+}
+
+// errMetadataOnlyFunctions is returned for expressions that call resource functions on kinds
+// counted from metadata only, since the functions would fail on every object.
+var errMetadataOnlyFunctions = errors.New("--where and --column can not call resource functions on kinds counted from metadata only, eg, with --count-only")
+
+// ExpressionOptions configures the per object --where filter and --column values.
+type ExpressionOptions struct {
+	Where   string
+	Columns columnList
+
+	where *Expression
+}
+
+func (o *ExpressionOptions) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Where, "where", "", `Only count objects matching the expression, eg, 'resource_replicas(self) > 3 && app_resource_limits(self, "memory") > 8Gi'`)
+	fs.Var(&o.Columns, "column", `Add a computed column to the per object table, eg, 'memory=total_resource_limits(self, "memory")'. Can be repeated.`)
+}
+
+func (o *ExpressionOptions) Complete() error {
+	if o.Where == "" {
+		return nil
+	}
+	var err error
+	o.where, err = ParseExpression(o.Where)
+	return err
+}
+
+// CallsFunctions reports whether --where or a --column calls a resource function,
+// which fails on objects counted from metadata only.
+func (o ExpressionOptions) CallsFunctions() bool {
+	if o.where != nil && o.where.CallsFunctions() {
+		return true
+	}
+	for _, col := range o.Columns {
+		if col.Expr.CallsFunctions() {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true if no --where expression is set or the object matches it.
+func (o ExpressionOptions) Match(obj map[string]interface{}) (bool, error) {
+	if o.where == nil {
+		return true, nil
+	}
+	return o.where.Match(obj)
+}
+
+// Values returns the formatted --column values of an object.
+func (o ExpressionOptions) Values(obj map[string]interface{}, r *Redactor) ([]string, error) {
+	values := make([]string, 0, len(o.Columns))
+	for _, col := range o.Columns {
+		v, err := col.Expr.Eval(obj)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := v.(string); ok {
+			v = r.Hash(s)
+		}
+		values = append(values, FormatValue(v))
+	}
+	return values, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		ch := rune(s[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case unicode.IsDigit(ch) || ch == '.' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1])):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			// exponent, eg, 1e3 or 2.5E-2, unlike the E and Ei quantity suffixes
+			if e := exponentLen(s[j:]); e > 0 {
+				j += e
+			}
+			k := j
+			for k < len(s) && unicode.IsLetter(rune(s[k])) {
+				k++
+			}
+			v, err := parseNumber(s[i:j], s[j:k])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: s[i:k], value: v})
+			i = k
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(s) && rune(s[j]) != ch {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			text := s[i : j+1]
+			v := s[i+1 : j]
+			if ch == '"' {
+				var err error
+				if v, err = strconv.Unquote(text); err != nil {
+					return nil, err
+				}
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, value: v})
+			i = j + 1
+		case unicode.IsLetter(ch) || ch == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: s[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")", ","} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", ch)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+func exponentLen(s string) int {
+	if len(s) < 2 || s[0] != 'e' && s[0] != 'E' {
+		return 0
+	}
+	i := 1
+	if s[i] == '+' || s[i] == '-' {
+		i++
+	}
+	j := i
+	for j < len(s) && unicode.IsDigit(rune(s[j])) {
+		j++
+	}
+	if j == i {
+		return 0
+	}
+	return j
+}
+
+// parseNumber parses a plain number or a resource quantity like 500m or 8Gi.
+func parseNumber(num, suffix string) (float64, error) {
+	if suffix == "" {
+		return strconv.ParseFloat(num, 64)
+	}
+	q, err := resource.ParseQuantity(num + suffix)
+	if err != nil {
+		return 0, err
+	}
+	// the exact decimal, MilliValue overflows for E and Ei
+	return strconv.ParseFloat(q.AsDec().String(), 64)
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	calls  bool
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) acceptOp(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseBinary(sub func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := sub()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := sub()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseComparison, "&&")
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	return p.parseBinary(p.parseAdditive, "==", "!=", "<=", ">=", "<", ">")
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	return p.parseBinary(p.parseUnary, "*", "/")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.acceptOp("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber, tokString:
+		return literalNode{value: t.value}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "nil", "null":
+			return literalNode{}, nil
+		}
+		if _, ok := p.acceptOp("("); !ok {
+			return fieldNode{path: strings.Split(t.text, ".")}, nil
+		}
+		fn, ok := resourcemetrics.EvalFuncs()[t.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %s", t.text)
+		}
+		p.calls = true
+		call := callNode{name: t.text, fn: fn}
+		if _, ok := p.acceptOp(")"); ok {
+			return call, nil
+		}
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if _, ok := p.acceptOp(")"); ok {
+				return call, nil
+			}
+			if _, ok := p.acceptOp(","); !ok {
+				return nil, fmt.Errorf("expected , or ) after argument of %s", t.text)
+			}
+		}
+	case tokOp:
+		if t.text == "(" {
+			e, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.acceptOp(")"); !ok {
+				return nil, errors.New("missing )")
+			}
+			return e, nil
+		}
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	default:
+		return nil, errors.New("unexpected end of expression")
+	}
+}
+
+type exprNode interface {
+	eval(self map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+// fieldNode resolves self or a dotted path below it. Missing fields are nil.
+type fieldNode struct {
+	path []string
+}
+
+func (n fieldNode) eval(self map[string]interface{}) (interface{}, error) {
+	if n.path[0] != "self" {
+		return nil, fmt.Errorf("unknown identifier %s, fields must start with self", strings.Join(n.path, "."))
+	}
+	var cur interface{} = self
+	for _, field := range n.path[1:] {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		cur = m[field]
+	}
+	return normalize(cur), nil
+}
+
+type callNode struct {
+	name string
+	fn   func(arguments ...interface{}) (interface{}, error)
+	args []exprNode
+}
+
+func (n callNode) eval(self map[string]interface{}) (result interface{}, err error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		v, err := arg.eval(self)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	// the resource-metrics functions type assert their arguments without checks
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("invalid arguments for %s: %v", n.name, e)
+		}
+	}()
+	v, err := n.fn(args...)
+	return normalize(v), err
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n unaryNode) eval(self map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(self)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		if v == nil {
+			return true, nil
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! requires a boolean, got %v", v)
+		}
+		return !b, nil
+	}
+	if v == nil {
+		return nil, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("- requires a number, got %v", v)
+	}
+	return -f, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n binaryNode) eval(self map[string]interface{}) (interface{}, error) {
+	l, err := n.left.eval(self)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "&&" || n.op == "||" {
+		lb, err := toBool(n.op, l)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "&&" && !lb || n.op == "||" && lb {
+			return lb, nil
+		}
+		r, err := n.right.eval(self)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(n.op, r)
+	}
+
+	r, err := n.right.eval(self)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "==" || n.op == "!=" {
+		if (l == nil || r == nil) && !isNilLiteral(n.left) && !isNilLiteral(n.right) {
+			return nil, nil
+		}
+		return reflect.DeepEqual(l, r) == (n.op == "=="), nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("can not compare %q with %v", ls, r)
+		}
+		switch n.op {
+		case "<":
+			return ls < rs, nil
+		case "<=":
+			return ls <= rs, nil
+		case ">":
+			return ls > rs, nil
+		case ">=":
+			return ls >= rs, nil
+		case "+":
+			return ls + rs, nil
+		}
+		return nil, fmt.Errorf("%s is not supported for strings", n.op)
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%s requires numbers, got %v and %v", n.op, l, r)
+	}
+	switch n.op {
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	case ">=":
+		return lf >= rf, nil
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	default:
+		if rf == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return lf / rf, nil
+	}
+}
+
+func isNilLiteral(n exprNode) bool {
+	lit, ok := n.(literalNode)
+	return ok && lit.value == nil
+}
+
+// toBool converts an operand of a boolean operator, nil is false.
+func toBool(op string, v interface{}) (bool, error) {
+	if v == nil {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s requires booleans, got %v", op, v)
+	}
+	return b, nil
+}
+
+// normalize converts all numbers to float64, so they can be compared with each other.
+func normalize(v interface{}) interface{} {
+	switch u := v.(type) {
+	case int:
+		return float64(u)
+	case int32:
+		return float64(u)
+	case int64:
+		return float64(u)
+	case float32:
+		return float64(u)
+	default:
+		return v
+	}
+}
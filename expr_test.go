@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+)
+
+func TestExpressionEval(t *testing.T) {
+	self := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "pg", "namespace": "demo"},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"paused":   false,
+			"storage":  "10Gi",
+		},
+	}
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		// precedence
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"8 / 4 / 2", 1.0},
+		{"-2 * 3", -6.0},
+		{"1 < 2 && 2 < 1 || true", true},
+		{"false && true || true", true},
+		{"true || false && false", true},
+		{"!false && !(1 > 2)", true},
+		{"1 + 1 == 2", true},
+		// numbers and quantities
+		{"1e3", 1000.0},
+		{"2.5E-1", 0.25},
+		{"1e+2 == 100", true},
+		{".5", 0.5},
+		{"500m", 0.5},
+		{"1Ki", 1024.0},
+		{"1E", 1e18},
+		{"2Ei > 1E", true},
+		{"8Gi > 8G", true},
+		// strings
+		{`"a" < "b"`, true},
+		{`'pg' == self.metadata.name`, true},
+		{`self.metadata.namespace + "/" + self.metadata.name`, "demo/pg"},
+		{`self.metadata.name >= "pa"`, true},
+		// fields
+		{"self.spec.replicas", 3.0},
+		{"self.spec.replicas > 2", true},
+		{"self.spec.paused", false},
+		{"self.spec.missing", nil},
+		{"self.metadata.name.x", nil},
+		// missing fields do not match
+		{"self.spec.missing > 2", nil},
+		{"self.spec.missing <= 2", nil},
+		{"-self.spec.missing", nil},
+		{"self.spec.missing + 1 > 2", nil},
+		{"self.spec.missing == nil", true},
+		{"nil != self.spec.missing", false},
+		{"self.spec.replicas != nil", true},
+		{"self.spec.missing == 2", nil},
+		{"self.spec.missing != 2", nil},
+		{"self.spec.missing != self.spec.other", nil},
+		{"self.spec.missing && true", false},
+		{"self.spec.missing || self.spec.replicas > 2", true},
+		{"!self.spec.missing", true},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpression(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		got, err := e.Eval(self)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %v (%T), want %v", tt.expr, got, got, tt.want)
+		}
+	}
+}
+
+func TestExpressionMatch(t *testing.T) {
+	self := map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(3)}}
+	tests := []struct {
+		expr    string
+		want    bool
+		wantErr bool
+	}{
+		{"self.spec.replicas > 2", true, false},
+		{"self.spec.replicas > 5", false, false},
+		{"self.spec.missing > 2", false, false},
+		{"self.spec.missing.deeper < 2", false, false},
+		{`self.spec.missing != "a"`, false, false},
+		{"self.spec.replicas", false, true},
+		{`self.spec.replicas > "a"`, false, true},
+		{`"a" * "b"`, false, true},
+		{"1 / 0 > 1", false, true},
+		{"unknown > 1", false, true},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		got, err := e.Match(self)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: got %v, %v, want %v, error %v", tt.expr, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 2",
+		`"unterminated`,
+		"1 # 2",
+		"nofunc(self)",
+		"1x",
+		"1e",
+	} {
+		if _, err := ParseExpression(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestColumnListSet(t *testing.T) {
+	var l columnList
+	if err := l.Set(`memory=total_resource_limits(self, "memory")`); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Set("replicas = self.spec.replicas"); err != nil {
+		t.Fatal(err)
+	}
+	if names := l.Names(); len(names) != 2 || names[0] != "memory" || names[1] != "replicas" {
+		t.Errorf("names = %v", names)
+	}
+	for _, v := range []string{"noexpr", "=1", "x=1 +"} {
+		if err := l.Set(v); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestExpressionOptionsValues(t *testing.T) {
+	var o ExpressionOptions
+	_ = o.Columns.Set("name=self.metadata.name")
+	_ = o.Columns.Set("replicas=self.spec.replicas")
+	_ = o.Columns.Set("missing=self.spec.missing")
+	obj := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "pg"},
+		"spec":     map[string]interface{}{"replicas": int64(3)},
+	}
+	values, err := o.Values(obj, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values[0] != "pg" || values[1] != "3" || values[2] != noneValue {
+		t.Errorf("values = %v", values)
+	}
+	r := &Redactor{salt: []byte("s")}
+	if values, _ := o.Values(obj, r); values[0] != r.Hash("pg") || values[1] != "3" {
+		t.Errorf("redacted values = %v", values)
+	}
+}
+
+func TestCollectWhereMissingField(t *testing.T) {
+	prio := newPod("demo", "b", "200m", "64Mi")
+	prio.Spec.Priority = pointer.Int32Ptr(10)
+	c := newTestClient(t, newPod("demo", "a", "100m", "64Mi"), prio)
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+
+	opts := CalculateOptions{Concurrency: 1, Expr: ExpressionOptions{Where: "self.spec.priority > 5"}}
+	if err := opts.Expr.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods}, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummary(t, report, pods, 1, "200m", "64Mi")
+}
+
+func TestExpressionCallsFunctions(t *testing.T) {
+	for expr, want := range map[string]bool{
+		"self.spec.replicas > 2":                                   false,
+		"resource_replicas(self) > 2":                              true,
+		`self.spec.paused || app_resource_limits(self, "cpu") > 1`: true,
+	} {
+		e, err := ParseExpression(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.CallsFunctions(); got != want {
+			t.Errorf("%s: got %v", expr, got)
+		}
+	}
+
+	var opts ExpressionOptions
+	if err := opts.Columns.Set(`memory=total_resource_limits(self, "memory")`); err != nil {
+		t.Fatal(err)
+	}
+	if !opts.CallsFunctions() {
+		t.Error("column calls a function")
+	}
+}
+
+func TestMetadataOnlyFunctions(t *testing.T) {
+	err := run(context.TODO(), []string{"--count-only", "--where", "resource_replicas(self) > 1"})
+	if !errors.Is(err, errMetadataOnlyFunctions) {
+		t.Errorf("summary: got %v", err)
+	}
+	err = run(context.TODO(), []string{"inventory", "--column", "replicas=resource_replicas(self)"})
+	if !errors.Is(err, errMetadataOnlyFunctions) {
+		t.Errorf("inventory: got %v", err)
+	}
+
+	c := newTestClient(t, newPod("demo", "a", "100m", "64Mi"))
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+	opts := CalculateOptions{Concurrency: 1, CountOnly: true, Expr: ExpressionOptions{Where: "resource_replicas(self) > 1"}}
+	if err := opts.Expr.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods}, nil, opts); !errors.Is(err, errMetadataOnlyFunctions) {
+		t.Errorf("collect: got %v", err)
+	}
+}
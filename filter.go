@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"path"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ObjectFilter limits the objects that are counted. Label and field selectors are
+// evaluated by the API server, namespace and age filters on the client.
+type ObjectFilter struct {
+	LabelSelector string
+	FieldSelector string
+	// namespace globs, eg, team-*. Cluster scoped objects are not filtered by namespace.
+	Namespaces        stringSlice
+	ExcludeNamespaces stringSlice
+	// only count objects created more than OlderThan or less than NewerThan ago
+	OlderThan time.Duration
+	NewerThan time.Duration
+
+	now time.Time
+}
+
+func (f *ObjectFilter) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.LabelSelector, "object-selector", "", "Label selector applied to the listed objects, eg, 'app.kubernetes.io/managed-by=kubedb.com'")
+	fs.StringVar(&f.FieldSelector, "field-selector", "", "Field selector applied to the listed objects, eg, 'metadata.namespace!=default'")
+	fs.Var(&f.Namespaces, "namespaces", "Namespaces to include, supports globs, eg, 'prod-*,billing'")
+	fs.Var(&f.ExcludeNamespaces, "exclude-namespaces", "Namespaces to exclude, supports globs, eg, 'kube-*'")
+	fs.DurationVar(&f.OlderThan, "older-than", 0, "Only count objects created longer ago than this, eg, 720h")
+	fs.DurationVar(&f.NewerThan, "newer-than", 0, "Only count objects created within this duration, eg, 24h")
+}
+
+// Complete validates the selectors and patterns and fixes the reference time used for the age filters.
+func (f *ObjectFilter) Complete() error {
+	if _, err := labels.Parse(f.LabelSelector); err != nil {
+		return err
+	}
+	if _, err := fields.ParseSelector(f.FieldSelector); err != nil {
+		return err
+	}
+	for _, pattern := range append(append([]string{}, f.Namespaces...), f.ExcludeNamespaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	f.now = time.Now()
+	return nil
+}
+
+// ListOptions returns the server side selectors. Complete must be called first.
+func (f ObjectFilter) ListOptions() []client.ListOption {
+	var opts []client.ListOption
+	if f.LabelSelector != "" {
+		s, _ := labels.Parse(f.LabelSelector)
+		opts = append(opts, client.MatchingLabelsSelector{Selector: s})
+	}
+	if f.FieldSelector != "" {
+		s, _ := fields.ParseSelector(f.FieldSelector)
+		opts = append(opts, client.MatchingFieldsSelector{Selector: s})
+	}
+	return opts
+}
+
+func matchesAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesNamespace returns false if objects in the namespace are filtered out.
+// The empty namespace is used for cluster scoped objects and always matches.
+func (f ObjectFilter) MatchesNamespace(ns string) bool {
+	if ns == metav1.NamespaceAll {
+		return true
+	}
+	if len(f.Namespaces) > 0 && !matchesAny(f.Namespaces, ns) {
+		return false
+	}
+	return !matchesAny(f.ExcludeNamespaces, ns)
+}
+
+// Matches applies the client side namespace and age filters.
+func (f ObjectFilter) Matches(obj metav1.Object) bool {
+	if !f.MatchesNamespace(obj.GetNamespace()) {
+		return false
+	}
+	age := f.now.Sub(obj.GetCreationTimestamp().Time)
+	if f.OlderThan > 0 && age < f.OlderThan {
+		return false
+	}
+	if f.NewerThan > 0 && age > f.NewerThan {
+		return false
+	}
+	return true
+}
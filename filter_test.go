@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestObjectFilterComplete(t *testing.T) {
+	for _, f := range []ObjectFilter{
+		{LabelSelector: "app in (a"},
+		{FieldSelector: "metadata.name"},
+		{Namespaces: stringSlice{"team-["}},
+		{ExcludeNamespaces: stringSlice{"[a"}},
+	} {
+		if err := f.Complete(); err == nil {
+			t.Errorf("%+v: expected an error", f)
+		}
+	}
+	f := ObjectFilter{LabelSelector: "app=web", FieldSelector: "metadata.name=a"}
+	if err := f.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(f.ListOptions()); got != 2 {
+		t.Errorf("got %d list options, want 2", got)
+	}
+}
+
+func TestObjectFilterMatches(t *testing.T) {
+	now := time.Now()
+	object := func(ns string, age time.Duration) metav1.Object {
+		return &metav1.ObjectMeta{Namespace: ns, CreationTimestamp: metav1.NewTime(now.Add(-age))}
+	}
+	tests := []struct {
+		name   string
+		filter ObjectFilter
+		obj    metav1.Object
+		want   bool
+	}{
+		{"no filter", ObjectFilter{}, object("demo", time.Hour), true},
+		{"included glob", ObjectFilter{Namespaces: stringSlice{"team-*"}}, object("team-a", 0), true},
+		{"not included", ObjectFilter{Namespaces: stringSlice{"team-*"}}, object("demo", 0), false},
+		{"excluded", ObjectFilter{ExcludeNamespaces: stringSlice{"kube-*"}}, object("kube-system", 0), false},
+		{"exclude wins", ObjectFilter{Namespaces: stringSlice{"*"}, ExcludeNamespaces: stringSlice{"demo"}}, object("demo", 0), false},
+		{"cluster scoped", ObjectFilter{Namespaces: stringSlice{"team-*"}}, object("", 0), true},
+		{"older than", ObjectFilter{OlderThan: 24 * time.Hour}, object("demo", 48*time.Hour), true},
+		{"too new", ObjectFilter{OlderThan: 24 * time.Hour}, object("demo", time.Hour), false},
+		{"newer than", ObjectFilter{NewerThan: 24 * time.Hour}, object("demo", time.Hour), true},
+		{"too old", ObjectFilter{NewerThan: 24 * time.Hour}, object("demo", 48*time.Hour), false},
+	}
+	for _, tt := range tests {
+		tt.filter.now = now
+		if got := tt.filter.Matches(tt.obj); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCollectFiltered(t *testing.T) {
+	labeled := newPod("demo", "b", "200m", "64Mi")
+	labeled.Labels = map[string]string{"app": "web"}
+	c := newTestClient(t,
+		newPod("demo", "a", "100m", "64Mi"),
+		labeled,
+		newPod("kube-system", "c", "300m", "128Mi"),
+	)
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+
+	filter := ObjectFilter{ExcludeNamespaces: stringSlice{"kube-*"}}
+	if err := filter.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods}, nil, CalculateOptions{Concurrency: 1, Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummary(t, report, pods, 2, "300m", "128Mi")
+
+	filter = ObjectFilter{LabelSelector: "app=web"}
+	if err := filter.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	report, err = collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods}, nil, CalculateOptions{Concurrency: 1, Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSummary(t, report, pods, 1, "200m", "64Mi")
+}
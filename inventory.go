@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+)
+
+// discoverAPIResources returns the resources served by the cluster, including CRDs and
+// aggregated APIs, keyed by GVK. If preferredOnly is set, only the preferred version of
+// each group is returned. Subresources are skipped. Groups that fail discovery
+// (eg, an unavailable aggregated API) are logged and skipped.
+func discoverAPIResources(dc discovery.DiscoveryInterface, preferredOnly bool) (map[schema.GroupVersionKind]metav1.APIResource, error) {
+	resourceLists, err := serverResources(dc, preferredOnly)
+	if err != nil {
+		return nil, err
+	}
+	return apiResourceMap(resourceLists)
+}
+
+// serverResources returns the resource lists of the discovery API, as stored in archives written by capture.
+func serverResources(dc discovery.DiscoveryInterface, preferredOnly bool) ([]*metav1.APIResourceList, error) {
+	var resourceLists []*metav1.APIResourceList
+	var err error
+	if preferredOnly {
+		resourceLists, err = dc.ServerPreferredResources()
+	} else {
+		_, resourceLists, err = dc.ServerGroupsAndResources()
+	}
+	if err != nil {
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return nil, err
+		}
+		klog.Warningln(err)
+	}
+	return resourceLists, nil
+}
+
+// apiResourceMap keys the resources by GVK and skips subresources.
+func apiResourceMap(resourceLists []*metav1.APIResourceList) (map[schema.GroupVersionKind]metav1.APIResource, error) {
+	result := map[schema.GroupVersionKind]metav1.APIResource{}
+	for _, rl := range resourceLists {
+		gv, err := schema.ParseGroupVersion(rl.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rl.APIResources {
+			if strings.Contains(r.Name, "/") {
+				continue
+			}
+			result[gv.WithKind(r.Kind)] = r
+		}
+	}
+	return result, nil
+}
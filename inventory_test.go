@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fakeDiscovery serves testResources, the preferred resources being the same,
+// and fails discovery of an aggregated API.
+type fakeDiscovery struct {
+	discovery.DiscoveryInterface
+}
+
+func (fakeDiscovery) ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	return nil, testResources, &discovery.ErrGroupDiscoveryFailed{
+		Groups: map[schema.GroupVersion]error{{Group: "metrics.k8s.io", Version: "v1beta1"}: errors.New("service unavailable")},
+	}
+}
+
+func (d fakeDiscovery) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	_, lists, err := d.ServerGroupsAndResources()
+	return lists, err
+}
+
+func TestDiscoverAPIResources(t *testing.T) {
+	resources, err := discoverAPIResources(fakeDiscovery{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postgres := schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"}
+	if res, ok := resources[postgres]; !ok || res.Name != "postgreses" {
+		t.Errorf("postgres: got %+v", res)
+	}
+	if len(resources) != 12 {
+		t.Errorf("got %d resources, want 12", len(resources))
+	}
+}
+
+func TestAPIResourceMap(t *testing.T) {
+	resources, err := apiResourceMap([]*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "pods", Kind: "Pod"},
+			{Name: "pods/status", Kind: "Pod"},
+			{Name: "pods/log", Kind: "Pod"},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := resources[core.SchemeGroupVersion.WithKind("Pod")]; len(resources) != 1 || res.Name != "pods" {
+		t.Errorf("subresources not skipped: %v", resources)
+	}
+
+	if _, err := apiResourceMap([]*metav1.APIResourceList{{GroupVersion: "a/b/c"}}); err == nil {
+		t.Error("expected an error for an invalid group version")
+	}
+}
+
+// failingClient fails the List calls of a kind with an error other than Forbidden.
+type failingClient struct {
+	client.Client
+	kind string
+}
+
+func (c failingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if strings.TrimSuffix(list.GetObjectKind().GroupVersionKind().Kind, "List") == c.kind {
+		return errors.New("the server is currently unable to handle the request")
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestCollectContinueOnError(t *testing.T) {
+	c := failingClient{
+		Client: newTestClient(t, newPod("demo", "a", "100m", "64Mi")),
+		kind:   "MongoDB",
+	}
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+	mongodb := schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "MongoDB"}
+	gvks := []schema.GroupVersionKind{pods, mongodb}
+
+	if _, err := collect(context.TODO(), c, testKubernetesInfo(), gvks, nil, CalculateOptions{Concurrency: 2, CountOnly: true}); err == nil {
+		t.Error("expected an error without ContinueOnError")
+	}
+
+	report, err := collect(context.TODO(), c, testKubernetesInfo(), gvks, nil, CalculateOptions{Concurrency: 2, CountOnly: true, ContinueOnError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Errors[mongodb] == nil || report.Errors[pods] != nil {
+		t.Errorf("errors = %v", report.Errors)
+	}
+	if got := report.Summaries[pods].Spec.Count; got != 1 {
+		t.Errorf("pods count = %d, want 1", got)
+	}
+}
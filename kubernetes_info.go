@@ -1,36 +1,85 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
 	"net"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	meta_util "kmodules.xyz/client-go/meta"
 	"kmodules.xyz/client-go/tools/clusterid"
 )
 
-func GetKubernetesInfo(cfg *rest.Config, kc kubernetes.Interface) (*KubernetesInfo, error) {
-	var si KubernetesInfo
+func GetKubernetesInfo(ctx context.Context, cfg *rest.Config, kc kubernetes.Interface) (*v1alpha1.KubernetesInfo, error) {
+	var si v1alpha1.KubernetesInfo
 
 	var err error
 	si.ClusterName = clusterid.ClusterName()
-	si.ClusterUID, err = clusterid.ClusterUID(kc.CoreV1().Namespaces())
-	if err != nil {
+	ns, err := kc.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil && !kerr.IsForbidden(err) {
 		return nil, err
+	} else if err == nil {
+		si.ClusterUID = string(ns.UID)
 	}
-	si.Version, err = kc.Discovery().ServerVersion()
+	si.Version, err = serverVersion(ctx, kc)
 	if err != nil {
 		return nil, err
 	}
 
-	cert, err := meta_util.APIServerCertificate(cfg)
+	// node and storage details are left empty for users without cluster wide read access
+	nodes, err := kc.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil && !kerr.IsForbidden(err) {
+		return nil, err
+	} else if err == nil {
+		si.Nodes = GetNodeInventory(nodes.Items)
+	} else {
+		nodes = &core.NodeList{}
+	}
+
+	scList, err := kc.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil && !kerr.IsForbidden(err) {
+		return nil, err
+	} else if err != nil {
+		scList = &storage.StorageClassList{}
+	}
+	for _, sc := range scList.Items {
+		si.StorageClasses = append(si.StorageClasses, v1alpha1.StorageClassInfo{
+			Name:        sc.Name,
+			Provisioner: sc.Provisioner,
+			IsDefault: sc.Annotations["storageclass.kubernetes.io/is-default-class"] == "true" ||
+				sc.Annotations["storageclass.beta.kubernetes.io/is-default-class"] == "true",
+		})
+	}
+
+	csiDrivers, err := kc.StorageV1().CSIDrivers().List(ctx, metav1.ListOptions{})
+	if err != nil && !kerr.IsNotFound(err) && !kerr.IsForbidden(err) {
+		return nil, err
+	} else if err == nil {
+		for _, d := range csiDrivers.Items {
+			si.CSIDrivers = append(si.CSIDrivers, d.Name)
+		}
+	}
+
+	cert, err := apiServerCertificate(ctx, cfg)
 	if err != nil {
 		return nil, err
 	} else {
-		si.ControlPlane = &ControlPlaneInfo{
+		si.ControlPlane = &v1alpha1.ControlPlaneInfo{
 			NotBefore: metav1.NewTime(cert.NotBefore),
 			NotAfter:  metav1.NewTime(cert.NotAfter),
 			// DNSNames:       cert.DNSNames,
@@ -75,10 +124,194 @@ func GetKubernetesInfo(cfg *rest.Config, kc kubernetes.Interface) (*KubernetesIn
 			uris = append(uris, u.String())
 		}
 		si.ControlPlane.URIs = uris
+
+		si.Provider = DetectProvider(si.Version.GitVersion, nodes.Items, cert.DNSNames)
 	}
 	return &si, nil
 }
 
+// apiServerCertificate is the context aware equivalent of meta_util.APIServerCertificate(cfg)
+func apiServerCertificate(ctx context.Context, cfg *rest.Config) (*x509.Certificate, error) {
+	cfg = rest.CopyConfig(cfg)
+	if err := rest.LoadTLSFiles(cfg); err != nil {
+		return nil, err
+	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(cfg.CAData) {
+		return nil, fmt.Errorf("can't append caCert to caCertPool")
+	}
+
+	tr := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     &tls.Config{RootCAs: caCertPool},
+	}
+	defer tr.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.Host, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	for i := range resp.TLS.VerifiedChains {
+		return resp.TLS.VerifiedChains[i][0], nil
+	}
+	return nil, fmt.Errorf("no cert found")
+}
+
+// serverVersion is the context aware equivalent of kc.Discovery().ServerVersion()
+func serverVersion(ctx context.Context, kc kubernetes.Interface) (*version.Info, error) {
+	body, err := kc.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+	var info version.Info
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("unable to parse the server version: %w", err)
+	}
+	return &info, nil
+}
+
+const (
+	ProviderEKS       = "EKS"
+	ProviderGKE       = "GKE"
+	ProviderAKS       = "AKS"
+	ProviderK3s       = "k3s"
+	ProviderKind      = "kind"
+	ProviderOpenShift = "OpenShift"
+	ProviderDOKS      = "DOKS"
+	ProviderLKE       = "LKE"
+)
+
+// DetectProvider makes a best effort guess of the Kubernetes distribution from
+// the server version, node labels and providerIDs and the API server certificate SANs.
+func DetectProvider(gitVersion string, nodes []core.Node, dnsNames []string) string {
+	switch {
+	case strings.Contains(gitVersion, "-eks-"):
+		return ProviderEKS
+	case strings.Contains(gitVersion, "-gke."):
+		return ProviderGKE
+	case strings.Contains(gitVersion, "+k3s"):
+		return ProviderK3s
+	}
+
+	for _, node := range nodes {
+		for k := range node.Labels {
+			switch {
+			case strings.HasPrefix(k, "node.openshift.io/"):
+				return ProviderOpenShift
+			case strings.HasPrefix(k, "eks.amazonaws.com/"):
+				return ProviderEKS
+			case strings.HasPrefix(k, "cloud.google.com/gke-"):
+				return ProviderGKE
+			case strings.HasPrefix(k, "kubernetes.azure.com/"):
+				return ProviderAKS
+			case strings.HasPrefix(k, "doks.digitalocean.com/"):
+				return ProviderDOKS
+			case strings.HasPrefix(k, "lke.linode.com/"):
+				return ProviderLKE
+			}
+		}
+	}
+
+	for _, host := range dnsNames {
+		switch {
+		case strings.HasSuffix(host, ".eks.amazonaws.com"):
+			return ProviderEKS
+		case strings.HasSuffix(host, ".azmk8s.io"):
+			return ProviderAKS
+		case strings.HasSuffix(host, ".openshiftapps.com"):
+			return ProviderOpenShift
+		case strings.HasSuffix(host, "-control-plane") && strings.HasPrefix(host, "kind"):
+			return ProviderKind
+		}
+	}
+
+	for _, node := range nodes {
+		switch {
+		case strings.HasPrefix(node.Spec.ProviderID, "kind://"):
+			return ProviderKind
+		case strings.HasPrefix(node.Spec.ProviderID, "k3s://"):
+			return ProviderK3s
+		case strings.HasPrefix(node.Spec.ProviderID, "azure://"):
+			return ProviderAKS
+		case strings.HasPrefix(node.Spec.ProviderID, "digitalocean://"):
+			return ProviderDOKS
+		case strings.HasPrefix(node.Spec.ProviderID, "linode://"):
+			return ProviderLKE
+		}
+	}
+	return ""
+}
+
+func GetNodeInventory(nodes []core.Node) *v1alpha1.NodeInventory {
+	inv := v1alpha1.NodeInventory{
+		Count:                    len(nodes),
+		Roles:                    map[string]int{},
+		OperatingSystems:         map[string]int{},
+		Architectures:            map[string]int{},
+		InstanceTypes:            map[string]int{},
+		Zones:                    map[string]int{},
+		KubeletVersions:          map[string]int{},
+		ContainerRuntimeVersions: map[string]int{},
+	}
+	for _, node := range nodes {
+		for _, role := range nodeRoles(node) {
+			inv.Roles[role]++
+		}
+		inv.OperatingSystems[node.Status.NodeInfo.OperatingSystem]++
+		inv.Architectures[node.Status.NodeInfo.Architecture]++
+		inv.InstanceTypes[firstLabel(node.Labels, core.LabelInstanceTypeStable, core.LabelInstanceType)]++
+		inv.Zones[firstLabel(node.Labels, core.LabelTopologyZone, core.LabelFailureDomainBetaZone)]++
+		inv.KubeletVersions[node.Status.NodeInfo.KubeletVersion]++
+		inv.ContainerRuntimeVersions[node.Status.NodeInfo.ContainerRuntimeVersion]++
+	}
+	return &inv
+}
+
+func nodeRoles(node core.Node) []string {
+	roles := sets.NewString()
+	for k, v := range node.Labels {
+		if strings.HasPrefix(k, "node-role.kubernetes.io/") {
+			if role := strings.TrimPrefix(k, "node-role.kubernetes.io/"); role != "" {
+				roles.Insert(role)
+			}
+		} else if k == "kubernetes.io/role" && v != "" {
+			roles.Insert(v)
+		}
+	}
+	if roles.Len() == 0 {
+		return []string{noneValue}
+	}
+	return roles.List()
+}
+
+func firstLabel(labels map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := labels[k]; ok && v != "" {
+			return v
+		}
+	}
+	return noneValue
+}
+
+// FormatCounts prints a count map as "k1=v1, k2=v2" sorted by key.
+func FormatCounts(m map[string]int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+strconv.Itoa(m[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
 func skipIP(ip net.IP) bool {
 	return ip.IsLoopback() ||
 		ip.IsMulticast() ||
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestDetectProvider(t *testing.T) {
+	labeled := func(k string) []core.Node {
+		return []core.Node{{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{k: "x"}}}}
+	}
+	providerID := func(id string) []core.Node {
+		return []core.Node{{Spec: core.NodeSpec{ProviderID: id}}}
+	}
+	tests := []struct {
+		name       string
+		gitVersion string
+		nodes      []core.Node
+		dnsNames   []string
+		want       string
+	}{
+		{"eks version", "v1.21.2-eks-0389ca3", nil, nil, ProviderEKS},
+		{"gke version", "v1.21.5-gke.1302", nil, nil, ProviderGKE},
+		{"k3s version", "v1.21.1+k3s1", nil, nil, ProviderK3s},
+		{"openshift label", "v1.21.1", labeled("node.openshift.io/os_id"), nil, ProviderOpenShift},
+		{"aks label", "v1.21.1", labeled("kubernetes.azure.com/cluster"), nil, ProviderAKS},
+		{"doks label", "v1.21.1", labeled("doks.digitalocean.com/node-id"), nil, ProviderDOKS},
+		{"aks san", "v1.21.1", nil, []string{"demo-dns-1234.hcp.eastus.azmk8s.io"}, ProviderAKS},
+		{"kind san", "v1.21.1", nil, []string{"kind-control-plane"}, ProviderKind},
+		{"kind provider id", "v1.21.1", providerID("kind://docker/kind/kind-control-plane"), nil, ProviderKind},
+		{"linode provider id", "v1.21.1", providerID("linode://1234"), nil, ProviderLKE},
+		{"unknown", "v1.21.1", providerID("aws:///us-east-1a/i-123"), []string{"api.example.com"}, ""},
+	}
+	for _, tt := range tests {
+		if got := DetectProvider(tt.gitVersion, tt.nodes, tt.dnsNames); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetNodeInventory(t *testing.T) {
+	node := func(labels map[string]string, arch string) core.Node {
+		return core.Node{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Status: core.NodeStatus{NodeInfo: core.NodeSystemInfo{
+				OperatingSystem:         "linux",
+				Architecture:            arch,
+				KubeletVersion:          "v1.21.1",
+				ContainerRuntimeVersion: "containerd://1.5.2",
+			}},
+		}
+	}
+	inv := GetNodeInventory([]core.Node{
+		node(map[string]string{
+			"node-role.kubernetes.io/control-plane": "",
+			"node-role.kubernetes.io/master":        "",
+			core.LabelTopologyZone:                  "us-east-1a",
+		}, "amd64"),
+		node(map[string]string{
+			"kubernetes.io/role":            "worker",
+			core.LabelInstanceType:          "m5.large",
+			core.LabelFailureDomainBetaZone: "us-east-1b",
+		}, "arm64"),
+		node(nil, "amd64"),
+	})
+
+	if inv.Count != 3 {
+		t.Errorf("count = %d, want 3", inv.Count)
+	}
+	checks := map[string]struct {
+		got  map[string]int
+		want map[string]int
+	}{
+		"roles":         {inv.Roles, map[string]int{"control-plane": 1, "master": 1, "worker": 1, noneValue: 1}},
+		"architectures": {inv.Architectures, map[string]int{"amd64": 2, "arm64": 1}},
+		"instance":      {inv.InstanceTypes, map[string]int{"m5.large": 1, noneValue: 2}},
+		"zones":         {inv.Zones, map[string]int{"us-east-1a": 1, "us-east-1b": 1, noneValue: 1}},
+		"kubelet":       {inv.KubeletVersions, map[string]int{"v1.21.1": 3}},
+	}
+	for name, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %v, want %v", name, c.got, c.want)
+		}
+	}
+}
+
+func TestFormatCounts(t *testing.T) {
+	if got := FormatCounts(map[string]int{"b": 2, "a": 1}); got != "a=1, b=2" {
+		t.Errorf("got %q", got)
+	}
+	if got := FormatCounts(nil); got != "" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestAPIServerCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	cfg := &rest.Config{
+		Host: srv.URL,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}),
+		},
+	}
+
+	cert, err := apiServerCertificate(context.TODO(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.Equal(srv.Certificate()) {
+		t.Errorf("got certificate of %s", cert.Subject)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := apiServerCertificate(ctx, cfg); err == nil {
+		t.Error("expected an error with a cancelled context")
+	}
+}
@@ -2,17 +2,30 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
-	"k8s.io/client-go/kubernetes"
-
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/util/sets"
-
-	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/klog/v2/klogr"
 	kubedbscheme "kubedb.dev/apimachinery/client/clientset/versioned/scheme"
 	schemav1alpha1 "kubedb.dev/schema-manager/apis/schema/v1alpha1"
@@ -20,6 +33,9 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 var (
@@ -27,63 +43,191 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+var (
+	impersonateUser   string
+	impersonateGroups stringSlice
+	timeout           time.Duration
+	fromArchive       string
+)
+
+// snapshot is the archive loaded for --from-archive. The commands read it instead of the live cluster.
+var snapshot *Archive
+
+func init() {
+	flag.DurationVar(&timeout, "timeout", 0, "Maximum duration of the command, eg, 5m. The partial result gathered so far is printed when it expires. Zero means no timeout.")
+	flag.StringVar(&impersonateUser, "as", "", "Username to impersonate for the operation")
+	flag.Var(&impersonateGroups, "as-group", "Group to impersonate for the operation, this flag can be repeated to specify multiple groups.")
+	flag.StringVar(&fromArchive, "from-archive", "", "Path to an archive written by capture. The reports are computed from the archive instead of a live cluster.")
+
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = kubedbscheme.AddToScheme(scheme)
+	_ = kubevaultscheme.AddToScheme(scheme)
+	_ = schemav1alpha1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+}
+
+// Command is a sub command of the tool. AddFlags registers the command specific
+// flags and Run is called once the flags are parsed.
+type Command struct {
+	AddFlags func(fs *flag.FlagSet)
+	Run      func(ctx context.Context, args []string) error
+}
+
+// commands maps a sub command name to its constructor. The first non flag
+// argument selects the command; summary is used when none is given.
+var commands = map[string]func() Command{
+	"summary":      newSummaryCommand,
+	"storage":      newStorageCommand,
+	"cluster-info": newClusterInfoCommand,
+	"inventory":    newInventoryCommand,
+	"check":        newCheckCommand,
+	"webhook":      newWebhookCommand,
+	"quota":        newQuotaCommand,
+	"reporter":     newReporterCommand,
+	"capture":      newCaptureCommand,
+	"explain":      newExplainCommand,
+	// commands with two words are selected by the first two arguments
+	"recommend quota": newRecommendQuotaCommand,
+}
+
+const (
+	// exit codes 1 and 2 are the WARNING and CRITICAL results of cluster-info checks,
+	// policy violations found by check use the CRITICAL code
+	exitCodeError      = 3
+	exitCodeIncomplete = 4
+)
+
+// exitError is returned by commands that completed but want the process to
+// exit with a specific non zero code (eg, a failed health check).
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e exitError) Error() string {
+	return e.msg
+}
+
 func main() {
-	/*
-	   k8s.io/group: apiextensions.k8s.io
-	   k8s.io/kind: CustomResourceDefinition
-	   k8s.io/resource: customresourcedefinitions
-	   k8s.io/version: v1
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		var ee exitError
+		if errors.As(err, &ee) {
+			_, _ = fmt.Fprintln(os.Stderr, ee.msg)
+			os.Exit(ee.code)
+		}
+		_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCodeError)
+	}
+}
 
-	*/
-	ls := metav1.LabelSelector{
-		//MatchLabels: map[string]string{
-		//	"k8s.io/group": "apps",
-		//},
-		MatchExpressions: []metav1.LabelSelectorRequirement{
-			{
-				Key:      "k8s.io/group",
-				Operator: metav1.LabelSelectorOpIn,
-				Values:   []string{"apps", "kubedb.com"},
-			},
-		},
-	}
-	s, err := metav1.LabelSelectorAsSelector(&ls)
-	if err != nil {
-		panic(err)
+func run(ctx context.Context, args []string) error {
+	name := "summary"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if len(args) > 0 {
+		if _, ok := commands[name+" "+args[0]]; ok {
+			name, args = name+" "+args[0], args[1:]
+		}
+	}
+	newCmd, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for k := range commands {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command %q, must be one of %s", name, strings.Join(names, ", "))
 	}
-	g, found := s.RequiresExactMatch("k8s.io/group")
-	fmt.Println("group = ", g)
-	fmt.Println("found = ", found)
 
-	requirements, selectable := s.Requirements()
-	if selectable {
-		fmt.Println("selectable")
+	cmd := newCmd()
+	fs := newFlagSet(name)
+	if cmd.AddFlags != nil {
+		cmd.AddFlags(fs)
 	}
-	for _, r := range requirements {
-		fmt.Println("key = ", r.Key())
-		fmt.Println("op = ", r.Operator())
-		fmt.Println("values = ", r.Values().List())
+	_ = fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := cmd.Run(ctx, fs.Args())
+	var ee exitError
+	if err != nil && ctx.Err() != nil && !errors.As(err, &ee) {
+		return exitError{code: exitCodeIncomplete, msg: fmt.Sprintf("incomplete result: %v", err)}
 	}
+	return err
+}
+
+// incompleteError is returned when the deadline was hit or the user interrupted
+// the command after a partial result was printed.
+func incompleteError(ctx context.Context) error {
+	return exitError{code: exitCodeIncomplete, msg: fmt.Sprintf("incomplete result: %v", ctx.Err())}
+}
 
-	fmt.Println(GetAPIGroups(s).List())
+// stringSlice is a flag.Value that accepts a comma separated list and can be repeated.
+type stringSlice []string
 
-	if err := run(); err != nil {
-		panic(err)
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*s = append(*s, part)
+		}
 	}
+	return nil
 }
 
-func run() error {
-	_ = clientgoscheme.AddToScheme(scheme)
-	_ = kubedbscheme.AddToScheme(scheme)
-	_ = kubevaultscheme.AddToScheme(scheme)
-	_ = schemav1alpha1.AddToScheme(scheme)
+// newFlagSet returns a FlagSet for a sub command that also accepts the global
+// flags (eg, --kubeconfig registered by controller-runtime).
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	return fs
+}
 
+// newClient returns a client of the live cluster or, with --from-archive, a client
+// that reads the archive. The rest config is nil in the latter case.
+// Requests made without a context through the returned config, like discovery,
+// are bound to ctx, so that --timeout and interrupts also stop them.
+func newClient(ctx context.Context) (*rest.Config, client.Client, error) {
 	ctrl.SetLogger(klogr.New())
+	if fromArchive != "" {
+		a, err := LoadArchive(fromArchive)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, err := a.Client()
+		if err != nil {
+			return nil, nil, err
+		}
+		snapshot = a
+		return nil, c, nil
+	}
+
 	cfg := ctrl.GetConfigOrDie()
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return contextTransport{ctx: ctx, rt: rt}
+	})
+	// keep the impersonation configured in the kubeconfig unless overridden
+	if impersonateUser != "" || len(impersonateGroups) > 0 {
+		cfg.Impersonate = rest.ImpersonationConfig{
+			UserName: impersonateUser,
+			Groups:   impersonateGroups,
+		}
+	}
 
 	mapper, err := apiutil.NewDynamicRESTMapper(cfg)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	c, err := client.New(cfg, client.Options{
@@ -95,33 +239,852 @@ func run() error {
 		},
 	})
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	return cfg, c, nil
+}
 
-	var n2 unstructured.UnstructuredList
-	n2.SetKind("Node")
-	n2.SetAPIVersion("v1")
-	err = c.List(context.TODO(), &n2)
-	if err != nil {
-		panic(err)
+// contextTransport binds the requests sent without a context to ctx.
+type contextTransport struct {
+	ctx context.Context
+	rt  http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Done() == nil {
+		req = req.WithContext(t.ctx)
 	}
-	for _, n := range n2.Items {
-		fmt.Println(n.GetName())
+	return t.rt.RoundTrip(req)
+}
+
+// kubernetesInfo returns the info of the live cluster or of the archive.
+func kubernetesInfo(ctx context.Context, cfg *rest.Config) (*v1alpha1.KubernetesInfo, error) {
+	if snapshot != nil {
+		return snapshot.KubernetesInfo, nil
 	}
+	return GetKubernetesInfo(ctx, cfg, kubernetes.NewForConfigOrDie(cfg))
+}
 
-	var nodes core.NodeList
-	err = c.List(context.TODO(), &nodes)
-	if err != nil {
-		panic(err)
+// apiResources returns the resource types served by the live cluster or by the captured cluster.
+func apiResources(cfg *rest.Config, preferredOnly bool) (map[schema.GroupVersionKind]metav1.APIResource, error) {
+	if snapshot == nil {
+		return discoverAPIResources(kubernetes.NewForConfigOrDie(cfg).Discovery(), preferredOnly)
+	}
+	if preferredOnly {
+		return apiResourceMap(snapshot.PreferredResources)
 	}
-	for _, n := range nodes.Items {
-		fmt.Println(n.Name)
+	return apiResourceMap(snapshot.Resources)
+}
+
+// kubeconfigNamespace returns the namespace of the current kubeconfig context
+// or the namespace of the pod when running in cluster.
+func kubeconfigNamespace() (string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if f := flag.Lookup("kubeconfig"); f != nil {
+		rules.ExplicitPath = f.Value.String()
 	}
+	ns, _, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).Namespace()
+	return ns, err
+}
 
-	ki, err := GetKubernetesInfo(cfg, kubernetes.NewForConfigOrDie(cfg))
-	if err != nil {
-		return err
+func newSummaryCommand() Command {
+	/*
+	   k8s.io/group: apiextensions.k8s.io
+	   k8s.io/kind: CustomResourceDefinition
+	   k8s.io/resource: customresourcedefinitions
+	   k8s.io/version: v1
+	   k8s.io/scope: Cluster
+	   category.k8s.io/all: "true"
+	*/
+	var (
+		selector      string
+		resourceKinds stringSlice
+		opts          CalculateOptions
+		redact        RedactOptions
+		watchMode     bool
+		tuiMode       bool
+		interval      time.Duration
+		notify        NotifyOptions
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&selector, "selector", "k8s.io/group=kubedb.com", "Label selector used to pick the resource types to list, eg, 'k8s.io/group notin (apps),k8s.io/kind in (Postgres,MySQL)'")
+			fs.StringVar(&selector, "l", "k8s.io/group=kubedb.com", "Shorthand for --selector")
+			fs.IntVar(&opts.Concurrency, "concurrency", 4, "Number of resource types listed in parallel")
+			fs.Int64Var(&opts.PageSize, "page-size", 500, "Maximum number of objects returned per List call. Set to 0 to disable paging.")
+			fs.BoolVar(&opts.ShowObjects, "objects", false, "Print a row for every object in addition to the per kind summary")
+			fs.BoolVar(&opts.CountOnly, "count-only", false, "Count objects per kind and namespace using metadata only lists, without calculating resources")
+			fs.Var(&resourceKinds, "resource-kinds", "Kinds, eg, Postgres.kubedb.com, whose resources are still calculated in --count-only mode")
+			fs.StringVar(&opts.GroupLabel, "group-label", "", "Label key used to group object counts, eg, app.kubernetes.io/name")
+			opts.Filter.AddFlags(fs)
+			opts.Output.AddFlags(fs)
+			opts.Expr.AddFlags(fs)
+			fs.BoolVar(&watchMode, "watch", false, "Keep the summary table on screen and refresh it every --interval, highlighting changes")
+			fs.DurationVar(&interval, "interval", 30*time.Second, "Refresh interval in --watch mode")
+			notify.AddFlags(fs)
+			fs.BoolVar(&tuiMode, "tui", false, "Browse the summary interactively, from kind to namespace, object and role")
+			redact.AddFlags(fs)
+		},
+		Run: func(ctx context.Context, _ []string) error {
+			s, err := labels.Parse(selector)
+			if err != nil {
+				return err
+			}
+			opts.ResourceKinds = sets.NewString(resourceKinds...)
+			if err := opts.Filter.Complete(); err != nil {
+				return err
+			}
+			if err := opts.Output.Complete(); err != nil {
+				return err
+			}
+			if err := opts.Expr.Complete(); err != nil {
+				return err
+			}
+			if opts.CountOnly && opts.Expr.CallsFunctions() {
+				return errMetadataOnlyFunctions
+			}
+			if watchMode && (opts.Output.Enabled() || opts.ShowObjects || len(opts.Expr.Columns) > 0) {
+				return errors.New("--watch only supports the summary table")
+			}
+			if tuiMode && (watchMode || opts.Output.Enabled()) {
+				return errors.New("--tui can not be combined with --watch or --output")
+			}
+			if tuiMode {
+				opts.ShowObjects = true
+			}
+			if watchMode && interval <= 0 {
+				return errors.New("--interval must be positive")
+			}
+			if notify.Enabled() && !watchMode {
+				return errors.New("--notify-webhook, --notify-slack and --notify-file require --watch")
+			}
+			if opts.Output.Uses("objects") || len(opts.Expr.Columns) > 0 || notify.Enabled() {
+				opts.ShowObjects = true
+			}
+
+			cfg, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			ki, err := kubernetesInfo(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			resources, err := apiResources(cfg, false)
+			if err != nil {
+				return err
+			}
+
+			r, err := redact.NewRedactor()
+			if err != nil {
+				return err
+			}
+
+			if tuiMode {
+				report, err := collect(ctx, c, ki, registeredGVKs(s, resources), r, opts)
+				if err != nil {
+					return err
+				}
+				return runTUI(ctx, report, r)
+			}
+			if watchMode {
+				var n *notifier
+				if notify.Enabled() {
+					n = &notifier{detector: notify.NewDetector(), sinks: notify.Sinks()}
+				}
+				return watch(ctx, os.Stdout, c, ki, registeredGVKs(s, resources), r, opts, interval, n)
+			}
+			return calculate(ctx, c, ki, registeredGVKs(s, resources), r, opts)
+		},
 	}
+}
+
+func newStorageCommand() Command {
+	var redact RedactOptions
+	return Command{
+		AddFlags: redact.AddFlags,
+		Run: func(ctx context.Context, _ []string) error {
+			_, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
 
-	return calculate(c, ki, sets.NewString("kubedb.com"))
+			r, err := redact.NewRedactor()
+			if err != nil {
+				return err
+			}
+			return calculateStorage(ctx, c, r)
+		},
+	}
+}
+
+func newClusterInfoCommand() Command {
+	var (
+		opts   ClusterInfoOptions
+		redact RedactOptions
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.DurationVar(&opts.CertWarning, "cert-warning", 30*24*time.Hour, "Warn if the API server certificate expires within this duration")
+			fs.DurationVar(&opts.CertCritical, "cert-critical", 7*24*time.Hour, "Fail if the API server certificate expires within this duration")
+			fs.IntVar(&opts.MaxKubeletSkew, "max-kubelet-skew", 2, "Maximum number of minor versions a kubelet may be older than the API server")
+			fs.IntVar(&opts.MaxNotReady, "max-not-ready", 1, "Maximum number of NotReady nodes reported as a WARNING. More NotReady nodes fail the readiness check.")
+			redact.AddFlags(fs)
+		},
+		Run: func(ctx context.Context, _ []string) error {
+			cfg, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			ki, err := kubernetesInfo(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			r, err := redact.NewRedactor()
+			if err != nil {
+				return err
+			}
+
+			status, err := clusterInfo(ctx, os.Stdout, c, ki, r, opts)
+			if err != nil {
+				return err
+			}
+			if status != CheckOK {
+				return exitError{code: int(status), msg: fmt.Sprintf("cluster-info: %s", status)}
+			}
+			return nil
+		},
+	}
+}
+
+func newInventoryCommand() Command {
+	var (
+		selector string
+		opts     = CalculateOptions{
+			CountOnly:       true,
+			ByNamespace:     true,
+			ContinueOnError: true,
+		}
+		resourceKinds stringSlice
+		redact        RedactOptions
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&selector, "selector", "", "Label selector used to pick the resource types to list, eg, 'k8s.io/scope=Namespaced,category.k8s.io/all'")
+			fs.StringVar(&selector, "l", "", "Shorthand for --selector")
+			fs.IntVar(&opts.Concurrency, "concurrency", 8, "Number of resource types listed in parallel")
+			fs.Int64Var(&opts.PageSize, "page-size", 500, "Maximum number of objects returned per List call. Set to 0 to disable paging.")
+			fs.Var(&resourceKinds, "resource-kinds", "Kinds with a resource calculator, eg, Postgres.kubedb.com, whose resources are calculated")
+			fs.StringVar(&opts.GroupLabel, "group-label", "", "Label key used to group object counts, eg, app.kubernetes.io/name")
+			opts.Filter.AddFlags(fs)
+			opts.Output.AddFlags(fs)
+			opts.Expr.AddFlags(fs)
+			redact.AddFlags(fs)
+		},
+		Run: func(ctx context.Context, _ []string) error {
+			s, err := labels.Parse(selector)
+			if err != nil {
+				return err
+			}
+			opts.ResourceKinds = sets.NewString(resourceKinds...)
+			if err := opts.Filter.Complete(); err != nil {
+				return err
+			}
+			if err := opts.Output.Complete(); err != nil {
+				return err
+			}
+			if err := opts.Expr.Complete(); err != nil {
+				return err
+			}
+			if opts.CountOnly && opts.Expr.CallsFunctions() {
+				return errMetadataOnlyFunctions
+			}
+			if opts.Output.Uses("objects") || len(opts.Expr.Columns) > 0 {
+				opts.ShowObjects = true
+			}
+
+			cfg, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			ki, err := kubernetesInfo(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			resources, err := apiResources(cfg, true)
+			if err != nil {
+				return err
+			}
+			gvks := make([]schema.GroupVersionKind, 0, len(resources))
+			for gvk, res := range resources {
+				if sets.NewString(res.Verbs...).Has("list") {
+					gvks = append(gvks, gvk)
+				}
+			}
+
+			r, err := redact.NewRedactor()
+			if err != nil {
+				return err
+			}
+
+			return calculate(ctx, c, ki, SelectGVKs(s, gvks, resources), r, opts)
+		},
+	}
+}
+
+func newCheckCommand() Command {
+	var (
+		selector   string
+		policyFile string
+		opts       = CalculateOptions{ShowObjects: true}
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&policyFile, "policy", "", "Path to the policy file with the budgets to check")
+			fs.StringVar(&selector, "selector", "", "Label selector used to pick the resource types to check, eg, 'k8s.io/group=kubedb.com'")
+			fs.StringVar(&selector, "l", "", "Shorthand for --selector")
+			fs.IntVar(&opts.Concurrency, "concurrency", 4, "Number of resource types listed in parallel")
+			fs.Int64Var(&opts.PageSize, "page-size", 500, "Maximum number of objects returned per List call. Set to 0 to disable paging.")
+			opts.Filter.AddFlags(fs)
+		},
+		Run: func(ctx context.Context, _ []string) error {
+			if policyFile == "" {
+				return errors.New("--policy is required")
+			}
+			policy, err := LoadPolicy(policyFile)
+			if err != nil {
+				return err
+			}
+			s, err := labels.Parse(selector)
+			if err != nil {
+				return err
+			}
+			if err := opts.Filter.Complete(); err != nil {
+				return err
+			}
+
+			cfg, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			ki, err := kubernetesInfo(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			resources, err := apiResources(cfg, false)
+			if err != nil {
+				return err
+			}
+			preferred, err := apiResources(cfg, true)
+			if err != nil {
+				return err
+			}
+
+			report, err := collect(ctx, c, ki, preferredGVKs(registeredGVKs(s, resources), preferred), nil, opts)
+			if err != nil {
+				return err
+			}
+			violations := policy.Check(report.Objects)
+			if err := printViolations(os.Stdout, violations); err != nil {
+				return err
+			}
+			if len(report.Incomplete) > 0 {
+				return incompleteError(ctx)
+			}
+			for gvk, access := range report.Access {
+				if !access.ClusterWide {
+					_, _ = fmt.Fprintf(os.Stderr, "Warning: %s was not listed in all namespaces, the check may be incomplete\n", gvk)
+				}
+			}
+			if len(violations) > 0 {
+				return exitError{code: int(CheckCritical), msg: fmt.Sprintf("%d policy violation(s)", len(violations))}
+			}
+			return nil
+		},
+	}
+}
+
+func newWebhookCommand() Command {
+	var (
+		policyFile string
+		host       string
+		port       int
+		certDir    string
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&policyFile, "policy", "", "Path to the policy file with the budgets to enforce")
+			fs.StringVar(&host, "host", "", "Address the webhook server listens on")
+			fs.IntVar(&port, "port", webhook.DefaultPort, "Port the webhook server listens on")
+			fs.StringVar(&certDir, "cert-dir", "", "Directory with the tls.crt and tls.key serving certificate")
+		},
+		Run: func(ctx context.Context, _ []string) error {
+			if policyFile == "" {
+				return errors.New("--policy is required")
+			}
+			if fromArchive != "" {
+				return errors.New("webhook can not be used with --from-archive")
+			}
+			policy, err := LoadPolicy(policyFile)
+			if err != nil {
+				return err
+			}
+
+			cfg, _, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+			preferred, err := apiResources(cfg, true)
+			if err != nil {
+				return err
+			}
+
+			mgr, err := manager.New(cfg, manager.Options{
+				Scheme:             scheme,
+				MetricsBindAddress: "0",
+				Host:               host,
+				Port:               port,
+				CertDir:            certDir,
+			})
+			if err != nil {
+				return err
+			}
+			gvks := policy.GVKs(preferred)
+			if err := watchLiveObjects(ctx, mgr.GetCache(), gvks); err != nil {
+				return err
+			}
+			mgr.GetWebhookServer().Register("/validate-budget", &webhook.Admission{Handler: &budgetValidator{
+				c:      mgr.GetCache(),
+				policy: policy,
+				gvks:   gvks,
+			}})
+			setupLog.Info("starting webhook server", "port", port, "path", "/validate-budget")
+			return mgr.Start(ctx)
+		},
+	}
+}
+
+// newReporterCommand runs in cluster. It installs the ResourceSummary CRD and, while it holds
+// the leader lease, writes one ResourceSummary per selected type and namespace every --interval.
+func newReporterCommand() Command {
+	var (
+		selector       string
+		namespace      string
+		interval       time.Duration
+		leaderElect    bool
+		metricsAddress string
+		probeAddress   string
+		opts           = CalculateOptions{ShowObjects: true, ContinueOnError: true}
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&selector, "selector", "k8s.io/group=kubedb.com", "Label selector used to pick the resource types to report")
+			fs.StringVar(&selector, "l", "k8s.io/group=kubedb.com", "Shorthand for --selector")
+			fs.StringVar(&namespace, "namespace", "", "Namespace of the leader election lock and of the summaries of cluster scoped types. Defaults to the namespace of the pod.")
+			fs.DurationVar(&interval, "interval", 5*time.Minute, "Interval between two reports")
+			fs.BoolVar(&leaderElect, "leader-elect", true, "Write the summaries only from the replica that holds the leader lease")
+			fs.StringVar(&metricsAddress, "metrics-bind-address", "0", "Address the metrics endpoint binds to. Set to 0 to disable.")
+			fs.StringVar(&probeAddress, "health-probe-bind-address", ":8081", "Address the health probe endpoint binds to")
+			fs.IntVar(&opts.Concurrency, "concurrency", 4, "Number of resource types listed in parallel")
+			fs.Int64Var(&opts.PageSize, "page-size", 500, "Maximum number of objects returned per List call. Set to 0 to disable paging.")
+		},
+		Run: func(ctx context.Context, _ []string) error {
+			s, err := labels.Parse(selector)
+			if err != nil {
+				return err
+			}
+			if interval <= 0 {
+				return errors.New("--interval must be positive")
+			}
+			if fromArchive != "" {
+				return errors.New("reporter can not be used with --from-archive")
+			}
+			if namespace == "" {
+				if namespace, err = kubeconfigNamespace(); err != nil {
+					return err
+				}
+			}
+
+			cfg, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+			if err := installCRDs(crd_cs.NewForConfigOrDie(cfg)); err != nil {
+				return err
+			}
+
+			ki, err := kubernetesInfo(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			resources, err := apiResources(cfg, false)
+			if err != nil {
+				return err
+			}
+
+			mgr, err := manager.New(cfg, manager.Options{
+				Scheme:                  scheme,
+				MetricsBindAddress:      metricsAddress,
+				HealthProbeBindAddress:  probeAddress,
+				LeaderElection:          leaderElect,
+				LeaderElectionID:        "resource-summary-reporter",
+				LeaderElectionNamespace: namespace,
+				// only needs RBAC for leases, see deploy/reporter.yaml
+				LeaderElectionResourceLock: resourcelock.LeasesResourceLock,
+			})
+			if err != nil {
+				return err
+			}
+			if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+				return err
+			}
+			if err := mgr.Add(&reporter{
+				c:         c,
+				ki:        ki,
+				gvks:      registeredGVKs(s, resources),
+				resources: resources,
+				namespace: namespace,
+				opts:      opts,
+				interval:  interval,
+			}); err != nil {
+				return err
+			}
+			setupLog.Info("starting reporter", "namespace", namespace, "interval", interval)
+			return mgr.Start(ctx)
+		},
+	}
+}
+
+// newCaptureCommand writes the objects of the selected types, together with the
+// cluster info and the discovery data, into an archive that --from-archive reads.
+func newCaptureCommand() Command {
+	var (
+		selector string
+		filename string
+		pageSize int64
+		redact   RedactOptions
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			redact.AddFlags(fs)
+			fs.StringVar(&filename, "file", "snapshot.tar.gz", "Path of the archive to write")
+			fs.StringVar(&selector, "selector", "", "Label selector used to pick the resource types to capture. Defaults to every type with a resource calculator.")
+			fs.StringVar(&selector, "l", "", "Shorthand for --selector")
+			fs.Int64Var(&pageSize, "page-size", 500, "Maximum number of objects returned per List call. Set to 0 to disable paging.")
+		},
+		Run: func(ctx context.Context, _ []string) error {
+			s, err := labels.Parse(selector)
+			if err != nil {
+				return err
+			}
+			if fromArchive != "" {
+				return errors.New("capture can not be used with --from-archive")
+			}
+			r, err := redact.NewRedactor()
+			if err != nil {
+				return err
+			}
+
+			cfg, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			kc := kubernetes.NewForConfigOrDie(cfg)
+			ki, err := GetKubernetesInfo(ctx, cfg, kc)
+			if err != nil {
+				return err
+			}
+			resources, err := serverResources(kc.Discovery(), false)
+			if err != nil {
+				return err
+			}
+			preferred, err := serverResources(kc.Discovery(), true)
+			if err != nil {
+				return err
+			}
+			served, err := apiResourceMap(resources)
+			if err != nil {
+				return err
+			}
+
+			gvks := registeredGVKs(s, served)
+			captured := sets.NewString()
+			for _, gvk := range gvks {
+				captured.Insert(gvk.String())
+			}
+			for _, gvk := range capturedTypes {
+				if _, found := served[gvk]; found && !captured.Has(gvk.String()) {
+					gvks = append(gvks, gvk)
+				}
+			}
+
+			f, err := os.Create(filename)
+			if err != nil {
+				return err
+			}
+			if err := Capture(ctx, f, c, ki, resources, preferred, gvks, pageSize, r); err != nil {
+				_ = f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "captured %d resource types into %s\n", len(gvks), filename)
+			return nil
+		},
+	}
+}
+
+// newExplainCommand shows how the resources of an object are computed and
+// how much each object of its kind contributes to the kind row of summary.
+func newExplainCommand() Command {
+	var (
+		namespace string
+		opts      = CalculateOptions{ShowObjects: true}
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&namespace, "namespace", "", "Namespace of the object. Defaults to the namespace of the current context, required with --from-archive.")
+			fs.StringVar(&namespace, "n", "", "Shorthand for --namespace")
+			fs.Int64Var(&opts.PageSize, "page-size", 500, "Maximum number of objects returned per List call. Set to 0 to disable paging.")
+		},
+		Run: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: explain <kind>[/<name>]")
+			}
+			kind, name := args[0], ""
+			if i := strings.Index(kind, "/"); i >= 0 {
+				kind, name = kind[:i], kind[i+1:]
+			}
+
+			cfg, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			ki, err := kubernetesInfo(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			resources, err := apiResources(cfg, false)
+			if err != nil {
+				return err
+			}
+			gvk, res, err := resolveKind(kind, resources)
+			if err != nil {
+				return err
+			}
+
+			var target metav1.Object
+			if name != "" {
+				if res.Namespaced && namespace == "" {
+					// the kubeconfig of the machine replaying an archive says nothing about the captured cluster
+					if fromArchive != "" {
+						return fmt.Errorf("--namespace is required to explain %s %s with --from-archive", gvk.Kind, name)
+					}
+					if namespace, err = kubeconfigNamespace(); err != nil {
+						return err
+					}
+				} else if !res.Namespaced {
+					namespace = ""
+				}
+				var obj unstructured.Unstructured
+				obj.SetGroupVersionKind(gvk)
+				if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &obj); err != nil {
+					return err
+				}
+				target = &obj
+				e, err := Explain(obj)
+				if err != nil {
+					return err
+				}
+				if err := printExplanation(os.Stdout, e); err != nil {
+					return err
+				}
+				_, _ = fmt.Fprintln(os.Stdout)
+			}
+
+			report, err := collect(ctx, c, ki, []schema.GroupVersionKind{gvk}, nil, opts)
+			if err != nil {
+				return err
+			}
+			if access, checked := report.Access[gvk]; checked && !access.ClusterWide {
+				_, _ = fmt.Fprintln(os.Stderr, "Warning: only the objects of the accessible namespaces are listed")
+			}
+			if err := printContributions(os.Stdout, gvk, report.Objects, target); err != nil {
+				return err
+			}
+			if report.Incomplete[gvk] {
+				return incompleteError(ctx)
+			}
+			return nil
+		},
+	}
+}
+
+func newQuotaCommand() Command {
+	var (
+		selector string
+		opts     = CalculateOptions{ShowObjects: true}
+		redact   RedactOptions
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&selector, "selector", "k8s.io/group=kubedb.com", "Label selector used to pick the resource types compared with the quotas")
+			fs.StringVar(&selector, "l", "k8s.io/group=kubedb.com", "Shorthand for --selector")
+			fs.IntVar(&opts.Concurrency, "concurrency", 4, "Number of resource types listed in parallel")
+			fs.Int64Var(&opts.PageSize, "page-size", 500, "Maximum number of objects returned per List call. Set to 0 to disable paging.")
+			opts.Filter.AddFlags(fs)
+			redact.AddFlags(fs)
+		},
+		Run: func(ctx context.Context, _ []string) error {
+			s, err := labels.Parse(selector)
+			if err != nil {
+				return err
+			}
+			if err := opts.Filter.Complete(); err != nil {
+				return err
+			}
+
+			cfg, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			ki, err := kubernetesInfo(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			resources, err := apiResources(cfg, false)
+			if err != nil {
+				return err
+			}
+
+			r, err := redact.NewRedactor()
+			if err != nil {
+				return err
+			}
+
+			quotas, limitRanges, err := listQuotas(ctx, c)
+			if err != nil {
+				return err
+			}
+
+			// objects are redacted when printed, so that they can be matched with the quotas
+			opts.LimitRanges = limitRanges
+			report, err := collect(ctx, c, ki, registeredGVKs(s, resources), nil, opts)
+			if err != nil {
+				return err
+			}
+			usages, violations := compareQuotas(report.Objects, report.Estimated, quotas)
+			if err := printQuotas(os.Stdout, usages, violations, r); err != nil {
+				return err
+			}
+			if len(report.Incomplete) > 0 {
+				return incompleteError(ctx)
+			}
+			return nil
+		},
+	}
+}
+
+func newRecommendQuotaCommand() Command {
+	var (
+		selector  string
+		headroom  string
+		quotaName string
+		opts      = CalculateOptions{ShowObjects: true}
+	)
+	return Command{
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&headroom, "headroom", "20%", "Headroom added on top of the current footprint, eg, 20%")
+			fs.StringVar(&quotaName, "name", "recommended-quota", "Name of the generated ResourceQuotas")
+			fs.StringVar(&selector, "selector", "k8s.io/group=kubedb.com", "Label selector used to pick the resource types included in the quotas")
+			fs.StringVar(&selector, "l", "k8s.io/group=kubedb.com", "Shorthand for --selector")
+			fs.IntVar(&opts.Concurrency, "concurrency", 4, "Number of resource types listed in parallel")
+			fs.Int64Var(&opts.PageSize, "page-size", 500, "Maximum number of objects returned per List call. Set to 0 to disable paging.")
+			opts.Filter.AddFlags(fs)
+		},
+		Run: func(ctx context.Context, _ []string) error {
+			h, err := ParseHeadroom(headroom)
+			if err != nil {
+				return err
+			}
+			s, err := labels.Parse(selector)
+			if err != nil {
+				return err
+			}
+			if err := opts.Filter.Complete(); err != nil {
+				return err
+			}
+
+			cfg, c, err := newClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			ki, err := kubernetesInfo(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			resources, err := apiResources(cfg, false)
+			if err != nil {
+				return err
+			}
+
+			report, err := collect(ctx, c, ki, registeredGVKs(s, resources), nil, opts)
+			if err != nil {
+				return err
+			}
+			if len(report.Incomplete) > 0 {
+				// quotas based on a partial footprint would be too small
+				return incompleteError(ctx)
+			}
+
+			// a quota charges every pod of its namespace, so they are not filtered by label
+			allPods, err := listPods(ctx, c)
+			if err != nil {
+				return err
+			}
+			pods := allPods[:0]
+			for _, pod := range allPods {
+				if opts.Filter.MatchesNamespace(pod.Namespace) {
+					pods = append(pods, pod)
+				}
+			}
+
+			pvcs, err := listClaims(ctx, c)
+			if err != nil {
+				return err
+			}
+			// like the pods, every claim of a namespace is charged, whatever its age or labels
+			claims := pvcs[:0]
+			for _, pvc := range pvcs {
+				if opts.Filter.MatchesNamespace(pvc.Namespace) {
+					claims = append(claims, pvc)
+				}
+			}
+
+			resourceOf := func(gk schema.GroupKind) (string, bool) {
+				mapping, err := c.RESTMapper().RESTMapping(gk)
+				if err != nil {
+					return "", false
+				}
+				return mapping.Resource.Resource, true
+			}
+			return printQuotaYAML(os.Stdout, RecommendQuotas(quotaName, report.Objects, pods, claims, h, resourceOf))
+		},
+	}
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hc := &http.Client{Transport: contextTransport{ctx: ctx, rt: http.DefaultTransport}}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := hc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	cancel()
+	// requests without a context are bound to the cancelled command context
+	req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	if _, err := hc.Do(req); err == nil {
+		t.Error("expected an error after the command context was cancelled")
+	}
+	// requests with their own context are left alone
+	own, cancelOwn := context.WithCancel(context.Background())
+	defer cancelOwn()
+	req, _ = http.NewRequestWithContext(own, http.MethodGet, srv.URL, nil)
+	resp, err = hc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+}
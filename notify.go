@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+)
+
+type EventType string
+
+const (
+	// the count or resources of a kind changed by more than the threshold
+	EventKindChanged EventType = "KindChanged"
+	// an object of a watched API group was created
+	EventObjectAdded EventType = "ObjectAdded"
+	// the kstatus of an object became Failed
+	EventObjectFailed EventType = "ObjectFailed"
+)
+
+// Event is the payload sent to the notification sinks.
+type Event struct {
+	Type     EventType                 `json:"type"`
+	Time     metav1.Time               `json:"time"`
+	Message  string                    `json:"message"`
+	Summary  *v1alpha1.ResourceSummary `json:"summary,omitempty"`
+	Previous *v1alpha1.ResourceSummary `json:"previous,omitempty"`
+	Object   *v1alpha1.GenericResource `json:"object,omitempty"`
+}
+
+// Sink delivers events, eg, to an HTTP endpoint or a file.
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+}
+
+// defaultNotifyTimeout bounds a single delivery, so an unresponsive endpoint
+// does not block the next --watch refresh.
+const defaultNotifyTimeout = 10 * time.Second
+
+// WebhookSink posts {"events": [...]} as JSON to URL.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = &http.Client{Timeout: defaultNotifyTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("POST %s returned %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *WebhookSink) Send(ctx context.Context, events []Event) error {
+	return postJSON(ctx, s.Client, s.URL, map[string]interface{}{"events": events})
+}
+
+// SlackSink posts the event messages to a Slack incoming webhook URL.
+type SlackSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *SlackSink) Send(ctx context.Context, events []Event) error {
+	lines := make([]string, 0, len(events))
+	for _, e := range events {
+		lines = append(lines, fmt.Sprintf("*%s* %s", e.Type, e.Message))
+	}
+	return postJSON(ctx, s.Client, s.URL, map[string]interface{}{"text": strings.Join(lines, "\n")})
+}
+
+// FileSink appends one JSON event per line to Path.
+type FileSink struct {
+	Path string
+}
+
+func (s *FileSink) Send(_ context.Context, events []Event) error {
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// NotifyOptions configures the sinks and thresholds used in --watch mode.
+type NotifyOptions struct {
+	Webhooks  stringSlice
+	Slack     stringSlice
+	File      string
+	Threshold float64
+	// maximum duration of a single webhook or Slack request
+	Timeout time.Duration
+	// API groups whose new objects are reported
+	NewObjectGroups stringSlice
+}
+
+func (o *NotifyOptions) AddFlags(fs *flag.FlagSet) {
+	fs.Var(&o.Webhooks, "notify-webhook", "URL that receives the --watch events as JSON. Can be repeated.")
+	fs.Var(&o.Slack, "notify-slack", "Slack incoming webhook URL that receives the --watch events. Can be repeated.")
+	fs.StringVar(&o.File, "notify-file", "", "File the --watch events are appended to as JSON lines")
+	fs.Float64Var(&o.Threshold, "notify-threshold", 10, "Percent change of a kind's count or resources that triggers a KindChanged event")
+	fs.DurationVar(&o.Timeout, "notify-timeout", defaultNotifyTimeout, "Timeout of a single request to a --notify-webhook or --notify-slack URL")
+	fs.Var(&o.NewObjectGroups, "notify-new-groups", "API groups whose new objects trigger an ObjectAdded event (default kubedb.com)")
+}
+
+func (o NotifyOptions) Enabled() bool {
+	return len(o.Webhooks) > 0 || len(o.Slack) > 0 || o.File != ""
+}
+
+func (o NotifyOptions) Sinks() []Sink {
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	var sinks []Sink
+	for _, u := range o.Webhooks {
+		sinks = append(sinks, &WebhookSink{URL: u, Client: client})
+	}
+	for _, u := range o.Slack {
+		sinks = append(sinks, &SlackSink{URL: u, Client: client})
+	}
+	if o.File != "" {
+		sinks = append(sinks, &FileSink{Path: o.File})
+	}
+	return sinks
+}
+
+func (o NotifyOptions) NewDetector() *ChangeDetector {
+	groups := sets.NewString(o.NewObjectGroups...)
+	if groups.Len() == 0 {
+		groups.Insert("kubedb.com")
+	}
+	return &ChangeDetector{Threshold: o.Threshold, NewObjectGroups: groups}
+}
+
+// ChangeDetector compares each report with the previous one. The first report is the baseline.
+type ChangeDetector struct {
+	Threshold       float64
+	NewObjectGroups sets.String
+
+	previous *Report
+}
+
+// percentChange returns the change from prev to cur in percent. Any change from zero is reported as infinite.
+func percentChange(prev, cur float64) float64 {
+	if prev == cur {
+		return 0
+	}
+	if prev == 0 {
+		return math.Inf(1)
+	}
+	return math.Abs(cur-prev) / math.Abs(prev) * 100
+}
+
+func quantityValue(name core.ResourceName, q resource.Quantity) float64 {
+	if name == core.ResourceCPU {
+		return float64(q.MilliValue()) / 1000
+	}
+	return float64(q.Value())
+}
+
+func objectKey(obj v1alpha1.GenericResource) types.UID {
+	if obj.UID != "" {
+		return obj.UID
+	}
+	return types.UID(objectRef(obj))
+}
+
+func (d *ChangeDetector) Detect(report *Report, now time.Time) []Event {
+	prev := d.previous
+	d.previous = report
+	if prev == nil {
+		return nil
+	}
+	ts := metav1.NewTime(now)
+
+	var events []Event
+	gvks := make([]schema.GroupVersionKind, 0, len(report.Summaries))
+	for gvk := range report.Summaries {
+		gvks = append(gvks, gvk)
+	}
+	sort.Slice(gvks, func(i, j int) bool {
+		return gvks[i].String() < gvks[j].String()
+	})
+	for _, gvk := range gvks {
+		cur, old := report.Summaries[gvk], prev.Summaries[gvk]
+		if report.Incomplete[gvk] || prev.Incomplete[gvk] {
+			continue
+		}
+		var changes []string
+		if p := percentChange(float64(old.Spec.Count), float64(cur.Spec.Count)); p > d.Threshold {
+			changes = append(changes, fmt.Sprintf("count %d → %d", old.Spec.Count, cur.Spec.Count))
+		}
+		for _, name := range []core.ResourceName{core.ResourceCPU, core.ResourceMemory, core.ResourceStorage} {
+			oq, cq := old.Spec.AppResource.Limits[name], cur.Spec.AppResource.Limits[name]
+			if p := percentChange(quantityValue(name, oq), quantityValue(name, cq)); p > d.Threshold {
+				changes = append(changes, fmt.Sprintf("%s %s → %s", name, oq.String(), cq.String()))
+			}
+		}
+		if len(changes) > 0 {
+			cur, old := cur, old
+			events = append(events, Event{
+				Type:     EventKindChanged,
+				Time:     ts,
+				Message:  fmt.Sprintf("%s changed: %s", gvk.GroupKind(), strings.Join(changes, ", ")),
+				Summary:  &cur,
+				Previous: &old,
+			})
+		}
+	}
+
+	known := map[types.UID]v1alpha1.GenericResource{}
+	for _, obj := range prev.Objects {
+		known[objectKey(obj)] = obj
+	}
+	for _, obj := range report.Objects {
+		obj := obj
+		old, found := known[objectKey(obj)]
+		if !found && d.NewObjectGroups.Has(obj.Spec.Group) {
+			events = append(events, Event{
+				Type:    EventObjectAdded,
+				Time:    ts,
+				Message: fmt.Sprintf("%s was created", objectRef(obj)),
+				Object:  &obj,
+			})
+		}
+		if obj.Status.Status == status.FailedStatus && (!found || old.Status.Status != status.FailedStatus) {
+			msg := objectRef(obj) + " failed"
+			if obj.Status.Message != "" {
+				msg += ": " + obj.Status.Message
+			}
+			events = append(events, Event{
+				Type:    EventObjectFailed,
+				Time:    ts,
+				Message: msg,
+				Object:  &obj,
+			})
+		}
+	}
+	return events
+}
+
+// notifier sends the detected changes to every sink.
+type notifier struct {
+	detector *ChangeDetector
+	sinks    []Sink
+}
+
+func (n *notifier) Notify(ctx context.Context, report *Report, now time.Time) error {
+	events := n.detector.Detect(report, now)
+	if len(events) == 0 {
+		return nil
+	}
+	var errs []string
+	for _, sink := range n.sinks {
+		if err := sink.Send(ctx, events); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send %d event(s): %s", len(events), strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+)
+
+var testEvents = []Event{
+	{Type: EventObjectAdded, Message: "Postgres.kubedb.com/demo/pg was created"},
+	{Type: EventObjectFailed, Message: "Postgres.kubedb.com/demo/pg failed"},
+}
+
+// recordServer returns a server that decodes the posted JSON body into v.
+func recordServer(t *testing.T, v interface{}) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebhookSink(t *testing.T) {
+	var body struct {
+		Events []Event `json:"events"`
+	}
+	srv := recordServer(t, &body)
+	if err := (&WebhookSink{URL: srv.URL}).Send(context.TODO(), testEvents); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Events) != 2 || body.Events[1].Type != EventObjectFailed {
+		t.Errorf("got %+v", body.Events)
+	}
+}
+
+func TestSlackSink(t *testing.T) {
+	var body struct {
+		Text string `json:"text"`
+	}
+	srv := recordServer(t, &body)
+	if err := (&SlackSink{URL: srv.URL}).Send(context.TODO(), testEvents); err != nil {
+		t.Fatal(err)
+	}
+	want := "*ObjectAdded* Postgres.kubedb.com/demo/pg was created\n*ObjectFailed* Postgres.kubedb.com/demo/pg failed"
+	if body.Text != want {
+		t.Errorf("got %q", body.Text)
+	}
+}
+
+func TestPostJSONErrors(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusForbidden)
+	}))
+	defer failing.Close()
+	err := (&WebhookSink{URL: failing.URL}).Send(context.TODO(), testEvents)
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden: invalid token") {
+		t.Errorf("got %v", err)
+	}
+
+	done := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer slow.Close()
+	defer close(done)
+	sinks := NotifyOptions{Webhooks: []string{slow.URL}, Timeout: 50 * time.Millisecond}.Sinks()
+	start := time.Now()
+	if err := sinks[0].Send(context.TODO(), testEvents); err == nil {
+		t.Error("expected a timeout")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("send took %s", d)
+	}
+}
+
+func TestNotifyOptionsSinks(t *testing.T) {
+	sinks := NotifyOptions{Webhooks: []string{"http://a"}, Slack: []string{"http://b"}, File: "events.json"}.Sinks()
+	if len(sinks) != 3 {
+		t.Fatalf("got %d sinks", len(sinks))
+	}
+	if c := sinks[0].(*WebhookSink).Client; c == nil || c.Timeout != defaultNotifyTimeout {
+		t.Errorf("webhook client = %+v", c)
+	}
+	if c := sinks[1].(*SlackSink).Client; c == nil || c.Timeout != defaultNotifyTimeout {
+		t.Errorf("slack client = %+v", c)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	sink := &FileSink{Path: path}
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(context.TODO(), testEvents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines int
+	for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lines != 4 {
+		t.Errorf("got %d lines, want 4 appended events", lines)
+	}
+
+	if err := (&FileSink{Path: filepath.Join(t.TempDir(), "missing", "events.json")}).Send(context.TODO(), testEvents); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestChangeDetectorDetect(t *testing.T) {
+	postgres := schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"}
+	pods := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	report := func(pgCount int, cpu string, objects ...v1alpha1.GenericResource) *Report {
+		return &Report{
+			Summaries: map[schema.GroupVersionKind]v1alpha1.ResourceSummary{
+				postgres: newSummary(pgCount, 1, cpu),
+				pods:     newSummary(10, 10, "1"),
+			},
+			Incomplete: map[schema.GroupVersionKind]bool{},
+			Objects:    objects,
+		}
+	}
+	pg := newGenericResource("Postgres.kubedb.com", "demo", "pg", "1", "")
+	pg.UID = "uid-pg"
+	pod := newGenericResource("Pod", "demo", "web", "1", "")
+	failed := pg
+	failed.Status.Status = status.FailedStatus
+	failed.Status.Message = "image pull failed"
+
+	d := &ChangeDetector{Threshold: 10, NewObjectGroups: sets.NewString("kubedb.com")}
+	if events := d.Detect(report(1, "1", pod), time.Now()); events != nil {
+		t.Fatalf("baseline reported %v", events)
+	}
+
+	var got []string
+	for _, e := range d.Detect(report(2, "1050m", pod, pg), time.Now()) {
+		got = append(got, string(e.Type)+": "+e.Message)
+	}
+	want := []string{
+		// cpu changed by 5%, below the threshold
+		"KindChanged: Postgres.kubedb.com changed: count 1 → 2",
+		"ObjectAdded: Postgres.kubedb.com/demo/pg was created",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	events := d.Detect(report(2, "1050m", pod, failed), time.Now())
+	if len(events) != 1 || events[0].Type != EventObjectFailed || events[0].Message != "Postgres.kubedb.com/demo/pg failed: image pull failed" {
+		t.Errorf("got %+v", events)
+	}
+	// a failed object is only reported once
+	if events := d.Detect(report(2, "1050m", pod, failed), time.Now()); len(events) != 0 {
+		t.Errorf("got %+v", events)
+	}
+
+	incomplete := report(5, "1050m", pod, failed)
+	incomplete.Incomplete[postgres] = true
+	if events := d.Detect(incomplete, time.Now()); len(events) != 0 {
+		t.Errorf("partial summaries must not be compared: %+v", events)
+	}
+}
+
+func TestNotifierErrors(t *testing.T) {
+	dir := t.TempDir()
+	n := &notifier{
+		detector: &ChangeDetector{NewObjectGroups: sets.NewString("kubedb.com")},
+		sinks:    []Sink{&FileSink{Path: filepath.Join(dir, "missing", "events.json")}, &FileSink{Path: filepath.Join(dir, "events.json")}},
+	}
+	pg := newGenericResource("Postgres.kubedb.com", "demo", "pg", "1", "")
+	if err := n.Notify(context.TODO(), &Report{}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	err := n.Notify(context.TODO(), &Report{Objects: []v1alpha1.GenericResource{pg}}, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "failed to send 1 event(s)") {
+		t.Errorf("got %v", err)
+	}
+	// the other sinks still receive the events
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "events.json")); err != nil || !strings.Contains(string(data), "ObjectAdded") {
+		t.Errorf("got %q, %v", data, err)
+	}
+}
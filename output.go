@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/jsonpath"
+	resourcemetrics "kmodules.xyz/resource-metrics"
+)
+
+// OutputOptions selects how a Report is printed. The default is a table, the
+// go-template, go-template-file and jsonpath formats are executed once against
+//
+//	summaries: one ResourceSummary per type
+//	objects:   one GenericResource per object, with the listed object under the "object" key
+//	           and the --column values under the "columns" key
+//
+// Templates can use the resource-metrics functions, eg, {{ k8s_resource_replicas .object }}.
+// Objects are only retained if the template refers to the objects field, and the
+// listed objects only if it refers to the object field, or if it prints the whole data.
+type OutputOptions struct {
+	Format string
+
+	print func(w io.Writer, data interface{}) error
+	// field names used by the template, allFields if it may print any field
+	fields sets.String
+}
+
+func (o *OutputOptions) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Format, "output", "", "Output format. One of: go-template=..., go-template-file=..., jsonpath=...")
+	fs.StringVar(&o.Format, "o", "", "Shorthand for --output")
+}
+
+// Complete parses the template, so that errors are reported before the cluster is listed.
+func (o *OutputOptions) Complete() error {
+	if o.Format == "" {
+		return nil
+	}
+	parts := strings.SplitN(o.Format, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("output format %q requires a template argument", o.Format)
+	}
+	format, arg := parts[0], parts[1]
+
+	switch format {
+	case "go-template-file":
+		data, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return err
+		}
+		arg = string(data)
+		fallthrough
+	case "go-template":
+		tpl, err := template.New("output").Funcs(resourcemetrics.TxtFuncMap()).Parse(arg)
+		if err != nil {
+			return fmt.Errorf("error parsing template %s: %w", arg, err)
+		}
+		tpl.Option("missingkey=error")
+		o.print = tpl.Execute
+		o.fields = templateFields(tpl)
+	case "jsonpath":
+		jp := jsonpath.New("output").AllowMissingKeys(true)
+		if err := jp.Parse(arg); err != nil {
+			return fmt.Errorf("error parsing jsonpath %s: %w", arg, err)
+		}
+		o.print = jp.Execute
+		p, err := jsonpath.Parse("output", arg)
+		if err != nil {
+			return fmt.Errorf("error parsing jsonpath %s: %w", arg, err)
+		}
+		o.fields = sets.NewString()
+		jsonpathFields(p.Root, o.fields)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	return nil
+}
+
+// Enabled returns true if the report is printed with a template instead of a table.
+func (o OutputOptions) Enabled() bool {
+	return o.print != nil
+}
+
+// Uses returns true if the template refers to the field of the template data or of an object.
+func (o OutputOptions) Uses(field string) bool {
+	return o.Enabled() && (o.fields.Has(field) || o.fields.Has(allFields))
+}
+
+// allFields marks templates that print a whole value, eg, {{ . }} or {.objects[*]}
+const allFields = "*"
+
+// templateFields returns the field names used by a go-template. Fields printed as
+// a whole, like the dot or the objects list, add allFields.
+func templateFields(tpl *template.Template) sets.String {
+	fields := sets.NewString()
+	var walk func(node parse.Node, printed bool)
+	walkBranch := func(n *parse.BranchNode) {
+		walk(n.Pipe, false)
+		walk(n.List, true)
+		walk(n.ElseList, true)
+	}
+	walk = func(node parse.Node, printed bool) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c, printed)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, true)
+		case *parse.IfNode:
+			walkBranch(&n.BranchNode)
+		case *parse.RangeNode:
+			walkBranch(&n.BranchNode)
+		case *parse.WithNode:
+			walkBranch(&n.BranchNode)
+		case *parse.TemplateNode:
+			walk(n.Pipe, true)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c, printed)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg, printed)
+			}
+		case *parse.FieldNode:
+			addFields(fields, n.Ident, printed)
+		case *parse.ChainNode:
+			walk(n.Node, printed)
+			addFields(fields, n.Field, printed)
+		case *parse.VariableNode:
+			addFields(fields, n.Ident[1:], printed)
+		case *parse.DotNode:
+			if printed {
+				fields.Insert(allFields)
+			}
+		case *parse.StringNode:
+			// eg, index . "object"
+			fields.Insert(n.Text)
+		}
+	}
+	for _, t := range tpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root, true)
+		}
+	}
+	return fields
+}
+
+// jsonpathFields adds the field names used by a jsonpath template. Printed paths ending at
+// the root or at the objects list, and recursive descent or wildcards, add allFields.
+func jsonpathFields(node jsonpath.Node, fields sets.String) {
+	switch n := node.(type) {
+	case *jsonpath.ListNode:
+		var path []string
+		// the path of {range ...} is iterated, not printed
+		printed := len(n.Nodes) == 0 || n.Nodes[0].Type() != jsonpath.NodeIdentifier
+		for _, c := range n.Nodes {
+			if f, ok := c.(*jsonpath.FieldNode); ok {
+				path = append(path, f.Value)
+			}
+			jsonpathFields(c, fields)
+		}
+		if len(path) > 0 {
+			addFields(fields, path, printed)
+		}
+	case *jsonpath.FieldNode:
+		fields.Insert(n.Value)
+	case *jsonpath.FilterNode:
+		jsonpathFields(n.Left, fields)
+		jsonpathFields(n.Right, fields)
+	case *jsonpath.UnionNode:
+		for _, l := range n.Nodes {
+			jsonpathFields(l, fields)
+		}
+	case *jsonpath.RecursiveNode, *jsonpath.WildcardNode:
+		fields.Insert(allFields)
+	}
+}
+
+// addFields adds a field path. A printed path that ends at the root or at the objects
+// list prints the objects as a whole, so it uses all of their fields.
+func addFields(fields sets.String, path []string, printed bool) {
+	fields.Insert(path...)
+	if printed && (len(path) == 0 || path[len(path)-1] == "" || path[len(path)-1] == "objects") {
+		fields.Insert(allFields)
+	}
+}
+
+func (o OutputOptions) Print(w io.Writer, report *Report, r *Redactor, columnNames []string) error {
+	if !o.Enabled() {
+		return errors.New("output format is not set")
+	}
+	data, err := templateData(report, r, columnNames)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := o.print(&buf, data); err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func rawObjectKey(gvk schema.GroupVersionKind, ns, name string) string {
+	return gvk.GroupKind().String() + "/" + ns + "/" + name
+}
+
+// toJSONMap converts v into the generic form used by encoding/json, so that
+// templates and jsonpath see the same field names as the JSON output.
+func toJSONMap(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+func templateData(report *Report, r *Redactor, columnNames []string) (map[string]interface{}, error) {
+	gvks := make([]schema.GroupVersionKind, 0, len(report.Summaries))
+	for gvk := range report.Summaries {
+		gvks = append(gvks, gvk)
+	}
+	gvks = SelectGVKs(labels.Everything(), gvks, nil)
+
+	summaries := make([]interface{}, 0, len(gvks))
+	for _, gvk := range gvks {
+		m, err := toJSONMap(report.Summaries[gvk])
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, m)
+	}
+
+	objects := make([]interface{}, 0, len(report.Objects))
+	for _, obj := range report.Objects {
+		m, err := toJSONMap(obj)
+		if err != nil {
+			return nil, err
+		}
+		gvk := schema.GroupVersionKind{Group: obj.Spec.Group, Version: obj.Spec.Version, Kind: obj.Spec.Kind}
+		if raw, ok := report.RawObjects[rawObjectKey(gvk, obj.Namespace, obj.Name)]; ok {
+			m["object"] = raw
+		}
+		if values, ok := report.Columns[rawObjectKey(gvk, obj.Namespace, obj.Name)]; ok {
+			columns := map[string]interface{}{}
+			for i, col := range columnNames {
+				columns[col] = values[i]
+			}
+			m["columns"] = columns
+		}
+		objects = append(objects, m)
+	}
+
+	return map[string]interface{}{
+		"clusterID": r.Hash(report.ClusterID),
+		"summaries": summaries,
+		"objects":   objects,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestOutputOptionsUses(t *testing.T) {
+	tests := []struct {
+		format           string
+		objects, objectF bool
+	}{
+		{"go-template={{ range .summaries }}{{ .spec.kind }} {{ .spec.count }}\n{{ end }}", false, false},
+		{"go-template={{ range .objects }}{{ .metadata.name }}\n{{ end }}", true, false},
+		{"go-template={{ range .objects }}{{ k8s_resource_replicas .object }}\n{{ end }}", true, true},
+		{`go-template={{ range $o := .objects }}{{ index $o "object" }}{{ end }}`, true, true},
+		{"go-template={{ .objects }}", true, true},
+		{"go-template={{ . }}", true, true},
+		{"go-template={{ .clusterID }}", false, false},
+		{"jsonpath={.summaries[*].spec.count}", false, false},
+		{"jsonpath={range .objects[*]}{.metadata.name}{end}", true, false},
+		{"jsonpath={range .objects[*]}{.object.spec.replicas}{end}", true, true},
+		{"jsonpath={.objects[*]}", true, true},
+		{"jsonpath={..replicas}", true, true},
+	}
+	for _, tt := range tests {
+		o := OutputOptions{Format: tt.format}
+		if err := o.Complete(); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if got := o.Uses("objects"); got != tt.objects {
+			t.Errorf("%s: uses objects = %v, want %v", tt.format, got, tt.objects)
+		}
+		if got := o.Uses("object"); got != tt.objectF {
+			t.Errorf("%s: uses object = %v, want %v", tt.format, got, tt.objectF)
+		}
+	}
+
+	if (OutputOptions{}).Uses("objects") {
+		t.Error("table output uses objects")
+	}
+}
+
+func TestOutputOptionsComplete(t *testing.T) {
+	for _, format := range []string{"go-template", "go-template=", "yaml=x", "go-template={{ .x", "jsonpath={.x"} {
+		o := OutputOptions{Format: format}
+		if err := o.Complete(); err == nil {
+			t.Errorf("%q: expected an error", format)
+		}
+	}
+}
+
+func TestOutputPrint(t *testing.T) {
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+	obj := v1alpha1.GenericResource{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "a"}}
+	obj.Spec.Version, obj.Spec.Kind = "v1", "Pod"
+	report := &Report{
+		ClusterID: "cluster-uid",
+		Summaries: map[schema.GroupVersionKind]v1alpha1.ResourceSummary{pods: {Spec: v1alpha1.ResourceSummarySpec{Kind: "Pod", Count: 1}}},
+		Objects:   []v1alpha1.GenericResource{obj},
+		RawObjects: map[string]map[string]interface{}{
+			rawObjectKey(pods, "demo", "a"): {"spec": map[string]interface{}{"nodeName": "node-1"}},
+		},
+		Columns: map[string][]string{rawObjectKey(pods, "demo", "a"): {"100m"}},
+	}
+	o := OutputOptions{Format: `go-template={{ .clusterID }}{{ range .summaries }} {{ .spec.kind }}={{ .spec.count }}{{ end }}{{ range .objects }} {{ .metadata.name }}:{{ .object.spec.nodeName }}:{{ .columns.cpu }}{{ end }}`}
+	if err := o.Complete(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := o.Print(&buf, report, nil, []string{"cpu"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "cluster-uid Pod=1 a:node-1:100m"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	r := &Redactor{salt: []byte("s")}
+	data, err := templateData(report, r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data["clusterID"]; got != r.Hash("cluster-uid") {
+		t.Errorf("cluster ID not redacted: %v", got)
+	}
+}
+
+func TestCollectRawObjects(t *testing.T) {
+	c := newTestClient(t, newPod("demo", "a", "100m", "64Mi"))
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+	for format, want := range map[string]int{
+		"go-template={{ range .objects }}{{ .metadata.name }}{{ end }}": 0,
+		"go-template={{ range .objects }}{{ .object.spec }}{{ end }}":   1,
+	} {
+		opts := CalculateOptions{Concurrency: 1, ShowObjects: true, Output: OutputOptions{Format: format}}
+		if err := opts.Output.Complete(); err != nil {
+			t.Fatal(err)
+		}
+		report, err := collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods}, nil, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Objects) != 1 || len(report.RawObjects) != want {
+			t.Errorf("%s: got %d objects and %d raw objects, want 1 and %d", format, len(report.Objects), len(report.RawObjects), want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"kmodules.xyz/resource-metrics/api"
+	"sigs.k8s.io/yaml"
+)
+
+// Policy is a list of budgets checked against the computed GenericResources, eg,
+//
+//	rules:
+//	- name: prod-databases
+//	  namespaces: ["prod-*"]
+//	  kinds: ["Postgres.kubedb.com", "MySQL.kubedb.com"]
+//	  per: namespace
+//	  maxRequests:
+//	    cpu: "16"
+//	    memory: 64Gi
+//	  maxCount: 10
+//	  deniedModes: ["Standalone"]
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+type PolicyRule struct {
+	Name string `json:"name"`
+	// namespace globs, all namespaces if empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// GroupKinds, eg, Postgres.kubedb.com, all kinds if empty. Objects controlled by
+	// another matching object, eg, the StatefulSet of a Postgres, are not counted.
+	Kinds []string `json:"kinds,omitempty"`
+	// label selector matched against the object labels
+	Selector string `json:"selector,omitempty"`
+	// Per groups the matching objects before the max values are checked. One of
+	// namespace (default), kind, label=<key>, cluster or object.
+	Per string `json:"per,omitempty"`
+
+	// maximum sum of the total resource requests and limits, including storage
+	MaxRequests core.ResourceList `json:"maxRequests,omitempty"`
+	MaxLimits   core.ResourceList `json:"maxLimits,omitempty"`
+	MaxCount    *int              `json:"maxCount,omitempty"`
+	MaxReplicas *int64            `json:"maxReplicas,omitempty"`
+
+	// modes each matching object must or must not use, eg, Standalone.
+	// Objects of kinds without modes are not checked.
+	AllowedModes []string `json:"allowedModes,omitempty"`
+	DeniedModes  []string `json:"deniedModes,omitempty"`
+
+	selector labels.Selector
+}
+
+// PolicyViolation is a rule that failed for a group of objects.
+type PolicyViolation struct {
+	Rule    string
+	Group   string
+	Message string
+	Objects []string
+}
+
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", filename, err)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if rule.selector, err = labels.Parse(rule.Selector); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		if _, err := rule.groupKey(v1alpha1.GenericResource{}); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+	return &p, nil
+}
+
+// GVKs returns the registered types the rules apply to, in their preferred version.
+func (p *Policy) GVKs(preferred map[schema.GroupVersionKind]metav1.APIResource) []schema.GroupVersionKind {
+	all := preferredGVKs(registeredGVKs(labels.Everything(), nil), preferred)
+	kinds := sets.NewString()
+	for _, rule := range p.Rules {
+		if len(rule.Kinds) == 0 {
+			return all
+		}
+		kinds.Insert(rule.Kinds...)
+	}
+	var result []schema.GroupVersionKind
+	for _, gvk := range all {
+		if kinds.Has(gvk.GroupKind().String()) {
+			result = append(result, gvk)
+		}
+	}
+	return result
+}
+
+func (rule PolicyRule) matches(obj v1alpha1.GenericResource) bool {
+	if len(rule.Namespaces) > 0 && !matchesAny(rule.Namespaces, obj.Namespace) {
+		return false
+	}
+	gk := schema.GroupKind{Group: obj.Spec.Group, Kind: obj.Spec.Kind}
+	if len(rule.Kinds) > 0 && !sets.NewString(rule.Kinds...).Has(gk.String()) {
+		return false
+	}
+	return rule.selector.Matches(labels.Set(obj.Labels))
+}
+
+func (rule PolicyRule) groupKey(obj v1alpha1.GenericResource) (string, error) {
+	switch per := rule.Per; {
+	case per == "" || per == "namespace":
+		return obj.Namespace, nil
+	case per == "kind":
+		return schema.GroupKind{Group: obj.Spec.Group, Kind: obj.Spec.Kind}.String(), nil
+	case per == "cluster":
+		return "*", nil
+	case per == "object":
+		return objectRef(obj), nil
+	case strings.HasPrefix(per, "label="):
+		key := strings.TrimPrefix(per, "label=")
+		if v, ok := obj.Labels[key]; ok {
+			return key + "=" + v, nil
+		}
+		return key + "=" + noneValue, nil
+	default:
+		return "", fmt.Errorf("unknown aggregation %q, must be one of namespace, kind, label=<key>, cluster or object", per)
+	}
+}
+
+func objectRef(obj v1alpha1.GenericResource) string {
+	ref := schema.GroupKind{Group: obj.Spec.Group, Kind: obj.Spec.Kind}.String() + "/"
+	if obj.Namespace != "" {
+		ref += obj.Namespace + "/"
+	}
+	return ref + obj.Name
+}
+
+// exceeded returns the resources in used that are above max.
+func exceeded(used, max core.ResourceList) []string {
+	var result []string
+	for name, limit := range max {
+		if q, ok := used[name]; ok && q.Cmp(limit) > 0 {
+			result = append(result, fmt.Sprintf("%s %s > %s", name, q.String(), limit.String()))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// controllerRefs maps the objectRef of every object with a controller to the objectRef of the controller.
+func controllerRefs(objects []v1alpha1.GenericResource) map[string]string {
+	parents := map[string]string{}
+	for i := range objects {
+		obj := &objects[i]
+		ref := metav1.GetControllerOf(obj)
+		if ref == nil {
+			continue
+		}
+		gv, _ := schema.ParseGroupVersion(ref.APIVersion)
+		parents[objectRef(*obj)] = objectRef(v1alpha1.GenericResource{
+			ObjectMeta: metav1.ObjectMeta{Namespace: obj.Namespace, Name: ref.Name},
+			Spec:       v1alpha1.GenericResourceSpec{Group: gv.Group, Kind: ref.Kind},
+		})
+	}
+	return parents
+}
+
+// topLevel drops the objects controlled, directly or through intermediate objects, by
+// another of the objects. The resources of a KubeDB database, its StatefulSet and its
+// Pods are then only counted once, against the database.
+func topLevel(objects []v1alpha1.GenericResource, parents map[string]string) []v1alpha1.GenericResource {
+	refs := sets.NewString()
+	for _, obj := range objects {
+		refs.Insert(objectRef(obj))
+	}
+	result := make([]v1alpha1.GenericResource, 0, len(objects))
+	for _, obj := range objects {
+		controlled := false
+		ref := objectRef(obj)
+		for i := 0; i < 5 && !controlled; i++ {
+			parent, ok := parents[ref]
+			if !ok {
+				break
+			}
+			controlled = refs.Has(parent)
+			ref = parent
+		}
+		if !controlled {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+// Check evaluates the policy against the objects and returns the violations sorted by rule and group.
+// Objects controlled by another object matching the same rule are not counted twice.
+func (p *Policy) Check(objects []v1alpha1.GenericResource) []PolicyViolation {
+	parents := controllerRefs(objects)
+	var violations []PolicyViolation
+	for _, rule := range p.Rules {
+		var matched []v1alpha1.GenericResource
+		for _, obj := range objects {
+			if rule.matches(obj) {
+				matched = append(matched, obj)
+			}
+		}
+
+		groups := map[string][]v1alpha1.GenericResource{}
+		for _, obj := range topLevel(matched, parents) {
+			key, _ := rule.groupKey(obj)
+			groups[key] = append(groups[key], obj)
+
+			// kinds whose calculator reports no mode, eg, Pods, have no mode to check
+			if mode := obj.Spec.Mode; mode != "" && (len(rule.AllowedModes) > 0 && !sets.NewString(rule.AllowedModes...).Has(mode) ||
+				sets.NewString(rule.DeniedModes...).Has(mode)) {
+				violations = append(violations, PolicyViolation{
+					Rule:    rule.Name,
+					Group:   key,
+					Message: fmt.Sprintf("mode %s is not allowed", mode),
+					Objects: []string{objectRef(obj)},
+				})
+			}
+		}
+
+		keys := make([]string, 0, len(groups))
+		for k := range groups {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			var requests, limits core.ResourceList
+			var replicas int64
+			refs := make([]string, 0, len(groups[key]))
+			for _, obj := range groups[key] {
+				requests = api.AddResourceList(requests, obj.Spec.TotalResource.Requests)
+				limits = api.AddResourceList(limits, obj.Spec.TotalResource.Limits)
+				replicas += obj.Spec.Replicas
+				refs = append(refs, objectRef(obj))
+			}
+
+			var msgs []string
+			for _, msg := range exceeded(requests, rule.MaxRequests) {
+				msgs = append(msgs, "requests "+msg)
+			}
+			for _, msg := range exceeded(limits, rule.MaxLimits) {
+				msgs = append(msgs, "limits "+msg)
+			}
+			if rule.MaxCount != nil && len(refs) > *rule.MaxCount {
+				msgs = append(msgs, fmt.Sprintf("count %d > %d", len(refs), *rule.MaxCount))
+			}
+			if rule.MaxReplicas != nil && replicas > *rule.MaxReplicas {
+				msgs = append(msgs, fmt.Sprintf("replicas %d > %d", replicas, *rule.MaxReplicas))
+			}
+			for _, msg := range msgs {
+				violations = append(violations, PolicyViolation{
+					Rule:    rule.Name,
+					Group:   key,
+					Message: msg,
+					Objects: refs,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// maxRefs limits the object references printed per violation.
+const maxRefs = 5
+
+func printViolations(out io.Writer, violations []PolicyViolation) error {
+	if len(violations) == 0 {
+		_, err := fmt.Fprintln(out, "no policy violations")
+		return err
+	}
+
+	const padding = 3
+	w := tabwriter.NewWriter(out, 0, 0, padding, ' ', tabwriter.TabIndent)
+	_, _ = fmt.Fprintln(w, "RULE\tGROUP\tVIOLATION\tOBJECTS\t")
+	for _, v := range violations {
+		refs := v.Objects
+		more := ""
+		if len(refs) > maxRefs {
+			more = fmt.Sprintf(" and %d more", len(refs)-maxRefs)
+			refs = refs[:maxRefs]
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s%s\t\n", v.Rule, v.Group, v.Message, strings.Join(refs, ", "), more)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+)
+
+// newGenericResource returns an object with the given cpu requests, optionally controlled by owner (Kind.group/name).
+func newGenericResource(gk, ns, name, cpu, owner string) v1alpha1.GenericResource {
+	parsed := schema.ParseGroupKind(gk)
+	obj := v1alpha1.GenericResource{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name, Labels: map[string]string{"team": ns}},
+		Spec: v1alpha1.GenericResourceSpec{
+			Group:    parsed.Group,
+			Version:  "v1",
+			Kind:     parsed.Kind,
+			Replicas: 1,
+			TotalResource: core.ResourceRequirements{
+				Requests: core.ResourceList{core.ResourceCPU: resource.MustParse(cpu)},
+			},
+		},
+	}
+	if owner != "" {
+		parts := strings.SplitN(owner, "/", 2)
+		ogk := schema.ParseGroupKind(parts[0])
+		obj.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: ogk.WithVersion("v1").GroupVersion().String(),
+			Kind:       ogk.Kind,
+			Name:       parts[1],
+			Controller: pointer.BoolPtr(true),
+		}}
+	}
+	return obj
+}
+
+func writePolicy(t *testing.T, policy string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := ioutil.WriteFile(filename, []byte(policy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := LoadPolicy(writePolicy(t, `
+rules:
+- kinds: ["Postgres.kubedb.com"]
+  maxCount: 1
+- name: teams
+  per: label=team
+  selector: team in (a,b)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Rules[0].Name != "rule-0" || p.Rules[1].Name != "teams" {
+		t.Errorf("names = %s, %s", p.Rules[0].Name, p.Rules[1].Name)
+	}
+
+	for _, policy := range []string{
+		"rules:\n- per: pod\n",
+		"rules:\n- selector: 'team in (a'\n",
+		"rules:\n- maxCPU: 1\n",
+	} {
+		if _, err := LoadPolicy(writePolicy(t, policy)); err == nil {
+			t.Errorf("%q: expected an error", policy)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	objects := []v1alpha1.GenericResource{
+		newGenericResource("Postgres.kubedb.com", "a", "pg", "2", ""),
+		newGenericResource("StatefulSet.apps", "a", "pg", "2", "Postgres.kubedb.com/pg"),
+		newGenericResource("Pod", "a", "pg-0", "1", "StatefulSet.apps/pg"),
+		newGenericResource("Pod", "a", "pg-1", "1", "StatefulSet.apps/pg"),
+		newGenericResource("Deployment.apps", "b", "web", "3", ""),
+		newGenericResource("ReplicaSet.apps", "b", "web-1", "3", "Deployment.apps/web"),
+		newGenericResource("Pod", "b", "web-1-x", "3", "ReplicaSet.apps/web-1"),
+		newGenericResource("Pod", "b", "debug", "1", ""),
+	}
+	objects[0].Spec.Mode = "Standalone"
+	three := resource.MustParse("3")
+
+	tests := []struct {
+		name string
+		rule PolicyRule
+		want []string
+	}{
+		{
+			// controlled objects are only counted against their top level owner
+			name: "all kinds",
+			rule: PolicyRule{MaxRequests: core.ResourceList{core.ResourceCPU: three}},
+			want: []string{"b: requests cpu 4 > 3"},
+		},
+		{
+			name: "count per cluster",
+			rule: PolicyRule{Per: "cluster", MaxCount: intPtr(2)},
+			want: []string{"*: count 3 > 2"},
+		},
+		{
+			// the pods of the StatefulSet are reached through the unselected StatefulSet
+			name: "database and pods",
+			rule: PolicyRule{Kinds: []string{"Postgres.kubedb.com", "Pod"}, Per: "kind", MaxCount: intPtr(1)},
+			want: []string{"Pod: count 2 > 1"},
+		},
+		{
+			name: "pods only",
+			rule: PolicyRule{Kinds: []string{"Pod"}, Namespaces: []string{"a"}, MaxReplicas: pointer.Int64Ptr(1)},
+			want: []string{"a: replicas 2 > 1"},
+		},
+		{
+			name: "denied mode",
+			rule: PolicyRule{Kinds: []string{"Postgres.kubedb.com"}, DeniedModes: []string{"Standalone"}},
+			want: []string{"a: mode Standalone is not allowed"},
+		},
+		{
+			name: "allowed modes",
+			rule: PolicyRule{Kinds: []string{"Postgres.kubedb.com"}, AllowedModes: []string{"Cluster"}, Per: "object"},
+			want: []string{"Postgres.kubedb.com/a/pg: mode Standalone is not allowed"},
+		},
+		{
+			// only the Postgres has a mode, the pods and workloads are not checked
+			name: "allowed modes of all kinds",
+			rule: PolicyRule{AllowedModes: []string{"Cluster"}},
+			want: []string{"a: mode Standalone is not allowed"},
+		},
+		{
+			name: "per label",
+			rule: PolicyRule{Per: "label=team", MaxCount: intPtr(1)},
+			want: []string{"team=b: count 2 > 1"},
+		},
+	}
+	for _, tt := range tests {
+		rule := tt.rule
+		rule.Name = tt.name
+		var err error
+		if rule.selector, err = labels.Parse(rule.Selector); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, v := range (&Policy{Rules: []PolicyRule{rule}}).Check(objects) {
+			got = append(got, v.Group+": "+v.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPreferredGVKs(t *testing.T) {
+	v1 := schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"}
+	v1beta1 := schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"}
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+
+	got := preferredGVKs([]schema.GroupVersionKind{v1beta1, pods, v1}, map[schema.GroupVersionKind]metav1.APIResource{v1: {}, pods: {}})
+	if want := []schema.GroupVersionKind{pods, v1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// without discovery info the first version is kept
+	got = preferredGVKs([]schema.GroupVersionKind{v1beta1, v1}, nil)
+	if want := []schema.GroupVersionKind{v1beta1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPrintViolations(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printViolations(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "no policy violations") {
+		t.Errorf("got %q", buf.String())
+	}
+
+	buf.Reset()
+	refs := []string{"a", "b", "c", "d", "e", "f", "g"}
+	if err := printViolations(&buf, []PolicyViolation{{Rule: "r", Group: "g", Message: "count 7 > 1", Objects: refs}}); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "a, b, c, d, e and 2 more") {
+		t.Errorf("got %q", out)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
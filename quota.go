@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"kmodules.xyz/resource-metrics/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// quotaResource maps a ResourceQuota resource name to the computed resource it limits.
+type quotaResource struct {
+	Name     core.ResourceName
+	Resource core.ResourceName
+	Limits   bool
+	// only listed if a quota sets it
+	Alias bool
+}
+
+// quotaResources are the ResourceQuota entries compared with the computed resources.
+// cpu and memory are aliases of requests.cpu and requests.memory.
+var quotaResources = []quotaResource{
+	{Name: core.ResourceRequestsCPU, Resource: core.ResourceCPU},
+	{Name: core.ResourceCPU, Resource: core.ResourceCPU, Alias: true},
+	{Name: core.ResourceRequestsMemory, Resource: core.ResourceMemory},
+	{Name: core.ResourceMemory, Resource: core.ResourceMemory, Alias: true},
+	{Name: core.ResourceLimitsCPU, Resource: core.ResourceCPU, Limits: true},
+	{Name: core.ResourceLimitsMemory, Resource: core.ResourceMemory, Limits: true},
+	{Name: core.ResourceRequestsStorage, Resource: core.ResourceStorage},
+}
+
+// QuotaUsage lines up a ResourceQuota entry with the computed resources of a namespace.
+type QuotaUsage struct {
+	Namespace string
+	Resource  core.ResourceName
+	// most restrictive quota of the namespace, empty if no quota sets the resource
+	Quota    string
+	Hard     *resource.Quantity
+	Used     *resource.Quantity
+	App      resource.Quantity
+	Total    resource.Quantity
+	Headroom *resource.Quantity
+	// Total includes LimitRange defaults for containers that set no requests or limits
+	Estimated bool
+}
+
+// ScaleUpViolation is an object whose next replica does not fit into the quota headroom.
+type ScaleUpViolation struct {
+	Namespace string
+	// GroupKind of the object, eg, Postgres.kubedb.com
+	Kind     string
+	Name     string
+	Resource core.ResourceName
+	Needed   resource.Quantity
+	Headroom resource.Quantity
+}
+
+// applyLimitRangeDefaults sets the container resources of an object the way the
+// API server would for its pods: a container that only sets a limit requests the
+// limit, then the LimitRangeItem defaults fill in the requests and limits a container
+// does not set. It returns true if any LimitRange default was applied.
+func applyLimitRangeDefaults(obj map[string]interface{}, limitRanges []core.LimitRange) (bool, error) {
+	estimated := false
+	for _, res := range containerResources(obj) {
+		var rr core.ResourceRequirements
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(res, &rr); err != nil {
+			return false, err
+		}
+		for name, q := range rr.Limits {
+			if _, ok := rr.Requests[name]; !ok {
+				if rr.Requests == nil {
+					rr.Requests = core.ResourceList{}
+				}
+				rr.Requests[name] = q.DeepCopy()
+			}
+		}
+		for _, lr := range limitRanges {
+			for _, item := range lr.Spec.Limits {
+				if item.Type != core.LimitTypeContainer {
+					continue
+				}
+				defaults, defaultRequests := limitRangeDefaults(item)
+				if setMissing(&rr.Limits, defaults) {
+					estimated = true
+				}
+				if setMissing(&rr.Requests, defaultRequests) {
+					estimated = true
+				}
+			}
+		}
+
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&rr)
+		if err != nil {
+			return false, err
+		}
+		delete(res, "requests")
+		delete(res, "limits")
+		for k, v := range u {
+			res[k] = v
+		}
+	}
+	return estimated, nil
+}
+
+// limitRangeDefaults returns the default limits and requests of a container LimitRangeItem,
+// with the fallbacks the API server sets when the LimitRange is created: the default limit
+// falls back to max, the default request to the default limit and then to min.
+func limitRangeDefaults(item core.LimitRangeItem) (core.ResourceList, core.ResourceList) {
+	defaults := core.ResourceList{}
+	for name, q := range item.Max {
+		defaults[name] = q
+	}
+	for name, q := range item.Default {
+		defaults[name] = q
+	}
+	requests := core.ResourceList{}
+	for name, q := range item.Min {
+		requests[name] = q
+	}
+	for name, q := range defaults {
+		requests[name] = q
+	}
+	for name, q := range item.DefaultRequest {
+		requests[name] = q
+	}
+	return defaults, requests
+}
+
+// setMissing copies the defaults that are not set in rl and returns true if any was copied.
+func setMissing(rl *core.ResourceList, defaults core.ResourceList) bool {
+	changed := false
+	for name, q := range defaults {
+		if _, ok := (*rl)[name]; ok {
+			continue
+		}
+		if *rl == nil {
+			*rl = core.ResourceList{}
+		}
+		(*rl)[name] = q.DeepCopy()
+		changed = true
+	}
+	return changed
+}
+
+// containerResources returns the resources field of every container of an object,
+// creating it if it is missing: the containers and initContainers of pod specs, and
+// the podTemplate and exporter of KubeDB databases and their topology nodes.
+// Storage and volume claim resources are not containers and are skipped.
+func containerResources(obj map[string]interface{}) []map[string]interface{} {
+	var result []map[string]interface{}
+	resources := func(m map[string]interface{}) {
+		res, ok := m["resources"].(map[string]interface{})
+		if !ok {
+			res = map[string]interface{}{}
+			m["resources"] = res
+		}
+		result = append(result, res)
+	}
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				switch k {
+				case "containers", "initContainers":
+					if containers, ok := child.([]interface{}); ok {
+						for _, c := range containers {
+							if c, ok := c.(map[string]interface{}); ok {
+								resources(c)
+							}
+						}
+					}
+					continue
+				case "podTemplate":
+					if tpl, ok := child.(map[string]interface{}); ok {
+						if spec, ok := tpl["spec"].(map[string]interface{}); ok {
+							resources(spec)
+						}
+					}
+					continue
+				case "exporter":
+					if exporter, ok := child.(map[string]interface{}); ok {
+						resources(exporter)
+					}
+					continue
+				case "storage", "volumeClaimTemplates":
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(obj)
+	return result
+}
+
+// perReplica returns the resources of a single replica, used to estimate the next scale-up.
+func perReplica(obj v1alpha1.GenericResource, name core.ResourceName, limits bool) resource.Quantity {
+	rl := obj.Spec.TotalResource.Requests
+	if limits {
+		rl = obj.Spec.TotalResource.Limits
+	}
+	q := rl[name]
+	if obj.Spec.Replicas <= 1 {
+		return q.DeepCopy()
+	}
+	if name == core.ResourceCPU {
+		return *resource.NewMilliQuantity(q.MilliValue()/obj.Spec.Replicas, q.Format)
+	}
+	return *resource.NewQuantity(q.Value()/obj.Spec.Replicas, q.Format)
+}
+
+// compareQuotas returns one QuotaUsage per namespace and quota resource, and the objects
+// whose next replica does not fit. Namespaces without a quota are listed with their computed resources.
+// estimated holds the objectRefs of the objects whose resources include LimitRange defaults.
+func compareQuotas(objects []v1alpha1.GenericResource, estimated sets.String, quotas []core.ResourceQuota) ([]QuotaUsage, []ScaleUpViolation) {
+	quotasByNs := map[string][]core.ResourceQuota{}
+	for _, q := range quotas {
+		quotasByNs[q.Namespace] = append(quotasByNs[q.Namespace], q)
+	}
+
+	objectsByNs := map[string][]v1alpha1.GenericResource{}
+	estimatedNs := map[string]bool{}
+	for _, obj := range objects {
+		if estimated.Has(objectRef(obj)) {
+			estimatedNs[obj.Namespace] = true
+		}
+		objectsByNs[obj.Namespace] = append(objectsByNs[obj.Namespace], obj)
+	}
+
+	namespaces := make([]string, 0, len(objectsByNs)+len(quotasByNs))
+	for ns := range objectsByNs {
+		namespaces = append(namespaces, ns)
+	}
+	for ns := range quotasByNs {
+		if _, ok := objectsByNs[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+
+	var usages []QuotaUsage
+	var violations []ScaleUpViolation
+	for _, ns := range namespaces {
+		var app, total core.ResourceRequirements
+		for _, obj := range objectsByNs[ns] {
+			app.Requests = api.AddResourceList(app.Requests, obj.Spec.AppResource.Requests)
+			app.Limits = api.AddResourceList(app.Limits, obj.Spec.AppResource.Limits)
+			total.Requests = api.AddResourceList(total.Requests, obj.Spec.TotalResource.Requests)
+			total.Limits = api.AddResourceList(total.Limits, obj.Spec.TotalResource.Limits)
+		}
+
+		for _, qr := range quotaResources {
+			u := QuotaUsage{Namespace: ns, Resource: qr.Name, Estimated: estimatedNs[ns]}
+			if qr.Limits {
+				u.App, u.Total = app.Limits[qr.Resource], total.Limits[qr.Resource]
+			} else {
+				u.App, u.Total = app.Requests[qr.Resource], total.Requests[qr.Resource]
+			}
+
+			// the quota with the least headroom is the one that blocks a scale-up
+			for _, q := range quotasByNs[ns] {
+				hard, ok := q.Status.Hard[qr.Name]
+				if !ok {
+					hard, ok = q.Spec.Hard[qr.Name]
+				}
+				if !ok {
+					continue
+				}
+				used := q.Status.Used[qr.Name]
+				headroom := hard.DeepCopy()
+				headroom.Sub(used)
+				if u.Headroom == nil || headroom.Cmp(*u.Headroom) < 0 {
+					u.Quota = q.Name
+					u.Hard, u.Used, u.Headroom = &hard, &used, &headroom
+				}
+			}
+			if u.Hard == nil && (qr.Alias || u.Total.IsZero()) {
+				continue
+			}
+			usages = append(usages, u)
+
+			if u.Headroom == nil {
+				continue
+			}
+			for _, obj := range objectsByNs[ns] {
+				needed := perReplica(obj, qr.Resource, qr.Limits)
+				if !needed.IsZero() && needed.Cmp(*u.Headroom) > 0 {
+					violations = append(violations, ScaleUpViolation{
+						Namespace: ns,
+						Kind:      schema.GroupKind{Group: obj.Spec.Group, Kind: obj.Spec.Kind}.String(),
+						Name:      obj.Name,
+						Resource:  qr.Name,
+						Needed:    needed,
+						Headroom:  *u.Headroom,
+					})
+				}
+			}
+		}
+	}
+	return usages, violations
+}
+
+func quantityOrNone(q *resource.Quantity) string {
+	if q == nil {
+		return "-"
+	}
+	return q.String()
+}
+
+func printQuotas(out io.Writer, usages []QuotaUsage, violations []ScaleUpViolation, r *Redactor) error {
+	const padding = 3
+	w := tabwriter.NewWriter(out, 0, 0, padding, ' ', tabwriter.TabIndent)
+	estimated := false
+	_, _ = fmt.Fprintln(w, "NAMESPACE\tRESOURCE\tQUOTA\tHARD\tUSED\tAPP\tTOTAL\tHEADROOM\t")
+	for _, u := range usages {
+		quota := r.Hash(u.Quota)
+		if quota == "" {
+			quota = noneValue
+		}
+		totalStr := u.Total.String()
+		if u.Estimated {
+			totalStr = "~" + totalStr
+			estimated = true
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			r.Hash(u.Namespace), u.Resource, quota, quantityOrNone(u.Hard), quantityOrNone(u.Used), u.App.String(), totalStr, quantityOrNone(u.Headroom))
+	}
+	if estimated {
+		_, _ = fmt.Fprintln(w, "~: includes LimitRange defaults for containers that set no requests or limits")
+	}
+
+	if len(violations) > 0 {
+		_, _ = fmt.Fprintln(w, "")
+		_, _ = fmt.Fprintln(w, "NAMESPACE\tOBJECT\tRESOURCE\tNEXT REPLICA\tHEADROOM\t")
+		for _, v := range violations {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", r.Hash(v.Namespace), v.Kind+"/"+r.Hash(v.Name), v.Resource, v.Needed.String(), v.Headroom.String())
+		}
+	}
+	return w.Flush()
+}
+
+// listQuotas returns the ResourceQuotas of the cluster and its LimitRanges by namespace.
+func listQuotas(ctx context.Context, c client.Client) ([]core.ResourceQuota, map[string][]core.LimitRange, error) {
+	var quotas core.ResourceQuotaList
+	if err := c.List(ctx, &quotas); err != nil {
+		return nil, nil, err
+	}
+	var limitRanges core.LimitRangeList
+	if err := c.List(ctx, &limitRanges); err != nil {
+		return nil, nil, err
+	}
+	byNamespace := map[string][]core.LimitRange{}
+	for _, lr := range limitRanges.Items {
+		byNamespace[lr.Namespace] = append(byNamespace[lr.Namespace], lr)
+	}
+	return quotas.Items, byNamespace, nil
+}
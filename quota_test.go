@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func newLimitRange(ns string, item core.LimitRangeItem) core.LimitRange {
+	item.Type = core.LimitTypeContainer
+	return core.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "defaults"},
+		Spec:       core.LimitRangeSpec{Limits: []core.LimitRangeItem{item}},
+	}
+}
+
+func nestedQuantity(t *testing.T, obj map[string]interface{}, fields ...string) string {
+	t.Helper()
+	v, _, err := unstructured.NestedString(obj, fields...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestApplyLimitRangeDefaults(t *testing.T) {
+	limitRanges := []core.LimitRange{newLimitRange("demo", core.LimitRangeItem{
+		Default:        core.ResourceList{core.ResourceCPU: resource.MustParse("1")},
+		DefaultRequest: core.ResourceList{core.ResourceCPU: resource.MustParse("100m")},
+		Max:            core.ResourceList{core.ResourceMemory: resource.MustParse("1Gi")},
+	})}
+
+	deploy := parseObject(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: demo
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: limited
+        resources:
+          limits:
+            cpu: 500m
+            memory: 256Mi
+      - name: empty
+`).Object
+	estimated, err := applyLimitRangeDefaults(deploy, limitRanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !estimated {
+		t.Error("defaults of the empty container not reported")
+	}
+	containers, _, _ := unstructured.NestedSlice(deploy, "spec", "template", "spec", "containers")
+	limited := containers[0].(map[string]interface{})
+	empty := containers[1].(map[string]interface{})
+	checks := []struct {
+		got, want string
+	}{
+		// a container with only a limit requests the limit, not the default request
+		{nestedQuantity(t, limited, "resources", "requests", "cpu"), "500m"},
+		{nestedQuantity(t, limited, "resources", "requests", "memory"), "256Mi"},
+		{nestedQuantity(t, empty, "resources", "requests", "cpu"), "100m"},
+		{nestedQuantity(t, empty, "resources", "limits", "cpu"), "1"},
+		// the default limit falls back to max, the default request to the default limit
+		{nestedQuantity(t, empty, "resources", "limits", "memory"), "1Gi"},
+		{nestedQuantity(t, empty, "resources", "requests", "memory"), "1Gi"},
+	}
+	for i, c := range checks {
+		if c.got != c.want {
+			t.Errorf("check %d: got %q, want %q", i, c.got, c.want)
+		}
+	}
+
+	// a container that sets every resource is not estimated, but still requests its limit
+	complete := parseObject(t, `
+apiVersion: v1
+kind: Pod
+metadata:
+  namespace: demo
+  name: pod
+spec:
+  containers:
+  - name: app
+    resources:
+      limits:
+        cpu: "2"
+        memory: 64Mi
+`).Object
+	if estimated, err := applyLimitRangeDefaults(complete, limitRanges); err != nil || estimated {
+		t.Errorf("complete container: estimated = %v, %v", estimated, err)
+	}
+	containers, _, _ = unstructured.NestedSlice(complete, "spec", "containers")
+	app := containers[0].(map[string]interface{})
+	if got := nestedQuantity(t, app, "resources", "requests", "cpu"); got != "2" {
+		t.Errorf("complete container requests cpu %q, want 2", got)
+	}
+}
+
+func TestContainerResources(t *testing.T) {
+	pg := parseObject(t, `
+apiVersion: kubedb.com/v1alpha2
+kind: Postgres
+metadata:
+  namespace: demo
+  name: pg
+spec:
+  podTemplate:
+    spec:
+      resources:
+        requests:
+          cpu: 250m
+  monitor:
+    prometheus:
+      exporter: {}
+  storage:
+    resources:
+      requests:
+        storage: 1Gi
+`).Object
+	if got := len(containerResources(pg)); got != 2 {
+		t.Errorf("got %d containers, want the database and the exporter", got)
+	}
+	if _, found, _ := unstructured.NestedMap(pg, "spec", "monitor", "prometheus", "exporter", "resources"); !found {
+		t.Error("missing exporter resources not created")
+	}
+	if got := nestedQuantity(t, pg, "spec", "storage", "resources", "requests", "storage"); got != "1Gi" {
+		t.Errorf("storage changed to %q", got)
+	}
+}
+
+func TestCompareQuotas(t *testing.T) {
+	pg := newGenericResource("Postgres.kubedb.com", "demo", "pg", "2", "")
+	pg.Spec.Replicas = 2
+	other := newGenericResource("Postgres.kubedb.com", "other", "pg", "1", "")
+	quota := core.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "compute"},
+		Spec:       core.ResourceQuotaSpec{Hard: core.ResourceList{core.ResourceRequestsCPU: resource.MustParse("2500m")}},
+		Status: core.ResourceQuotaStatus{
+			Hard: core.ResourceList{core.ResourceRequestsCPU: resource.MustParse("2500m")},
+			Used: core.ResourceList{core.ResourceRequestsCPU: resource.MustParse("2")},
+		},
+	}
+
+	usages, violations := compareQuotas([]v1alpha1.GenericResource{pg, other}, sets.NewString(objectRef(other)), []core.ResourceQuota{quota})
+	if len(usages) != 2 {
+		t.Fatalf("got %d usages, want one requests.cpu per namespace: %+v", len(usages), usages)
+	}
+	demo, o := usages[0], usages[1]
+	if demo.Quota != "compute" || demo.Headroom.Cmp(resource.MustParse("500m")) != 0 || demo.Estimated {
+		t.Errorf("demo: %+v", demo)
+	}
+	if o.Hard != nil || !o.Estimated || o.Total.Cmp(resource.MustParse("1")) != 0 {
+		t.Errorf("other: %+v", o)
+	}
+	if len(violations) != 1 || violations[0].Kind != "Postgres.kubedb.com" || violations[0].Name != "pg" ||
+		violations[0].Needed.Cmp(resource.MustParse("1")) != 0 {
+		t.Errorf("violations = %+v", violations)
+	}
+}
+
+func TestPrintQuotas(t *testing.T) {
+	r := &Redactor{salt: []byte("s")}
+	hard, used, headroom := resource.MustParse("2"), resource.MustParse("2"), resource.MustParse("0")
+	usages := []QuotaUsage{{
+		Namespace: "demo", Resource: core.ResourceRequestsCPU, Quota: "compute",
+		Hard: &hard, Used: &used, Headroom: &headroom, Total: resource.MustParse("2"), Estimated: true,
+	}}
+	violations := []ScaleUpViolation{{
+		Namespace: "demo", Kind: "Postgres.kubedb.com", Name: "pg", Resource: core.ResourceRequestsCPU,
+		Needed: resource.MustParse("1"), Headroom: headroom,
+	}}
+
+	var buf bytes.Buffer
+	if err := printQuotas(&buf, usages, violations, r); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Postgres.kubedb.com/"+r.Hash("pg")) {
+		t.Errorf("kind must stay readable, only the name is hashed:\n%s", out)
+	}
+	if strings.Contains(out, "demo") || strings.Contains(out, "compute") {
+		t.Errorf("namespace or quota name not redacted:\n%s", out)
+	}
+	if !strings.Contains(out, "~2") {
+		t.Errorf("estimated total not marked:\n%s", out)
+	}
+}
+
+func TestCollectLimitRangeDefaults(t *testing.T) {
+	pod := newPod("demo", "a", "100m", "64Mi")
+	pod.Spec.Containers = append(pod.Spec.Containers, core.Container{
+		Name:      "sidecar",
+		Resources: core.ResourceRequirements{Limits: core.ResourceList{core.ResourceCPU: resource.MustParse("200m")}},
+	})
+	c := newTestClient(t, pod)
+	pods := core.SchemeGroupVersion.WithKind("Pod")
+	limitRanges := map[string][]core.LimitRange{"demo": {newLimitRange("demo", core.LimitRangeItem{
+		DefaultRequest: core.ResourceList{core.ResourceMemory: resource.MustParse("32Mi")},
+	})}}
+
+	opts := CalculateOptions{Concurrency: 1, ShowObjects: true, LimitRanges: limitRanges}
+	report, err := collect(context.TODO(), c, testKubernetesInfo(), []schema.GroupVersionKind{pods}, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sidecar requests its cpu limit and the default memory request
+	checkSummary(t, report, pods, 1, "300m", "96Mi")
+	if !report.Estimated.Has(objectRef(report.Objects[0])) {
+		t.Errorf("estimated = %v", report.Estimated.List())
+	}
+}
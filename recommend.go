@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kmodules.xyz/resource-metrics/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// ParseHeadroom parses a headroom like 20% or 0.2 into a fraction.
+func ParseHeadroom(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid headroom %q", s)
+		}
+		return v / 100, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid headroom %q", s)
+	}
+	return v, nil
+}
+
+// withHeadroom grows q by the headroom and rounds it up to 100m for cpu and 1Mi for everything else.
+func withHeadroom(name core.ResourceName, q resource.Quantity, headroom float64) resource.Quantity {
+	if name == core.ResourceCPU {
+		const step = 100
+		m := int64(math.Ceil(float64(q.MilliValue())*(1+headroom)/step)) * step
+		return *resource.NewMilliQuantity(m, resource.DecimalSI)
+	}
+	const step = 1 << 20
+	v := int64(math.Ceil(float64(q.Value())*(1+headroom)/step)) * step
+	return *resource.NewQuantity(v, resource.BinarySI)
+}
+
+// storageClassQuota returns the per StorageClass quota name, eg, standard.storageclass.storage.k8s.io/requests.storage
+func storageClassQuota(sc string) core.ResourceName {
+	return core.ResourceName(sc + ".storageclass.storage.k8s.io/" + string(core.ResourceRequestsStorage))
+}
+
+// podResources returns the requests and limits a ResourceQuota charges for a pod: the
+// larger of the sum of its containers and its largest init container, plus the pod overhead.
+func podResources(pod core.Pod) core.ResourceRequirements {
+	var containers, init core.ResourceRequirements
+	for _, c := range pod.Spec.Containers {
+		containers.Requests = api.AddResourceList(containers.Requests, c.Resources.Requests)
+		containers.Limits = api.AddResourceList(containers.Limits, c.Resources.Limits)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		init.Requests = api.MaxResourceList(init.Requests, c.Resources.Requests)
+		init.Limits = api.MaxResourceList(init.Limits, c.Resources.Limits)
+	}
+	return core.ResourceRequirements{
+		Requests: api.AddResourceList(api.MaxResourceList(containers.Requests, init.Requests), pod.Spec.Overhead),
+		Limits:   api.AddResourceList(api.MaxResourceList(containers.Limits, init.Limits), pod.Spec.Overhead),
+	}
+}
+
+// RecommendQuotas returns a ResourceQuota per namespace of the listed objects that fits the
+// current footprint plus the headroom. Namespaces without listed objects, eg, kube-system, get
+// no quota. A quota charges every pod of its namespace, so cpu and memory come from all pods
+// that are not terminated, not only from the pods of the listed objects. Storage comes from
+// the PersistentVolumeClaims and object counts from the listed objects, using the resource
+// names returned by resourceOf.
+func RecommendQuotas(name string, objects []v1alpha1.GenericResource, pods []core.Pod, pvcs []core.PersistentVolumeClaim, headroom float64, resourceOf func(gk schema.GroupKind) (string, bool)) []core.ResourceQuota {
+	type footprint struct {
+		total   core.ResourceRequirements
+		storage core.ResourceList
+		counts  map[core.ResourceName]int64
+	}
+	namespaces := map[string]*footprint{}
+	for _, obj := range objects {
+		if obj.Namespace == "" {
+			continue
+		}
+		fp, ok := namespaces[obj.Namespace]
+		if !ok {
+			fp = &footprint{storage: core.ResourceList{}, counts: map[core.ResourceName]int64{}}
+			namespaces[obj.Namespace] = fp
+		}
+		gk := schema.GroupKind{Group: obj.Spec.Group, Kind: obj.Spec.Kind}
+		if res, ok := resourceOf(gk); ok {
+			fp.counts[core.ResourceName("count/"+schema.GroupResource{Group: gk.Group, Resource: res}.String())]++
+		}
+	}
+	for _, pod := range pods {
+		fp, ok := namespaces[pod.Namespace]
+		if !ok || pod.Status.Phase == core.PodSucceeded || pod.Status.Phase == core.PodFailed {
+			continue
+		}
+		rr := podResources(pod)
+		fp.total.Requests = api.AddResourceList(fp.total.Requests, rr.Requests)
+		fp.total.Limits = api.AddResourceList(fp.total.Limits, rr.Limits)
+	}
+	for _, pvc := range pvcs {
+		fp, ok := namespaces[pvc.Namespace]
+		if !ok {
+			continue
+		}
+		q := pvc.Spec.Resources.Requests[core.ResourceStorage]
+		add := func(name core.ResourceName) {
+			sum := fp.storage[name]
+			sum.Add(q)
+			fp.storage[name] = sum
+		}
+		add(core.ResourceRequestsStorage)
+		if sc := pvc.Spec.StorageClassName; sc != nil && *sc != "" {
+			add(storageClassQuota(*sc))
+		}
+	}
+
+	names := make([]string, 0, len(namespaces))
+	for ns := range namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	quotas := make([]core.ResourceQuota, 0, len(names))
+	for _, ns := range names {
+		fp := namespaces[ns]
+		hard := core.ResourceList{}
+		set := func(quotaName, res core.ResourceName, rl core.ResourceList) {
+			if q, ok := rl[res]; ok && !q.IsZero() {
+				hard[quotaName] = withHeadroom(res, q, headroom)
+			}
+		}
+		set(core.ResourceRequestsCPU, core.ResourceCPU, fp.total.Requests)
+		set(core.ResourceRequestsMemory, core.ResourceMemory, fp.total.Requests)
+		set(core.ResourceLimitsCPU, core.ResourceCPU, fp.total.Limits)
+		set(core.ResourceLimitsMemory, core.ResourceMemory, fp.total.Limits)
+		for res, q := range fp.storage {
+			if !q.IsZero() {
+				hard[res] = withHeadroom(core.ResourceStorage, q, headroom)
+			}
+		}
+		for res, n := range fp.counts {
+			hard[res] = *resource.NewQuantity(int64(math.Ceil(float64(n)*(1+headroom))), resource.DecimalSI)
+		}
+		if len(hard) == 0 {
+			continue
+		}
+
+		quotas = append(quotas, core.ResourceQuota{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: core.SchemeGroupVersion.String(),
+				Kind:       "ResourceQuota",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+			},
+			Spec: core.ResourceQuotaSpec{
+				Hard: hard,
+			},
+		})
+	}
+	return quotas
+}
+
+func printQuotaYAML(out io.Writer, quotas []core.ResourceQuota) error {
+	for i, q := range quotas {
+		data, err := yaml.Marshal(q)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := fmt.Fprintln(out, "---"); err != nil {
+				return err
+			}
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listPods returns the pods used for the cpu and memory quotas.
+func listPods(ctx context.Context, c client.Client) ([]core.Pod, error) {
+	var pods core.PodList
+	if err := c.List(ctx, &pods); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// listClaims returns the PersistentVolumeClaims used for the storage quotas.
+func listClaims(ctx context.Context, c client.Client) ([]core.PersistentVolumeClaim, error) {
+	var pvcs core.PersistentVolumeClaimList
+	if err := c.List(ctx, &pvcs); err != nil {
+		return nil, err
+	}
+	return pvcs.Items, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseHeadroom(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		err  bool
+	}{
+		{"20%", 0.2, false},
+		{" 0.5 ", 0.5, false},
+		{"0%", 0, false},
+		{"-10%", 0, true},
+		{"-0.1", 0, true},
+		{"ten%", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseHeadroom(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("%q: got %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestWithHeadroom(t *testing.T) {
+	if got := withHeadroom(core.ResourceCPU, resource.MustParse("1"), 0.25); got.String() != "1300m" {
+		t.Errorf("cpu: got %s, want 1300m", got.String())
+	}
+	if got := withHeadroom(core.ResourceMemory, resource.MustParse("100Mi"), 0.2); got.String() != "120Mi" {
+		t.Errorf("memory: got %s, want 120Mi", got.String())
+	}
+}
+
+func TestPodResources(t *testing.T) {
+	pod := *newPod("demo", "a", "100m", "64Mi")
+	pod.Spec.Containers = append(pod.Spec.Containers, newPod("", "", "100m", "64Mi").Spec.Containers...)
+	pod.Spec.InitContainers = newPod("", "", "500m", "32Mi").Spec.Containers
+	pod.Spec.Overhead = core.ResourceList{core.ResourceCPU: resource.MustParse("50m")}
+
+	requests := podResources(pod).Requests
+	// the init container has the largest cpu, the containers the largest memory
+	if requests.Cpu().Cmp(resource.MustParse("550m")) != 0 || requests.Memory().Cmp(resource.MustParse("128Mi")) != 0 {
+		t.Errorf("requests = %v", requests)
+	}
+}
+
+func TestRecommendQuotas(t *testing.T) {
+	pg := newGenericResource("Postgres.kubedb.com", "demo", "pg", "2", "")
+	done := *newPod("demo", "job", "4", "1Gi")
+	done.Status.Phase = core.PodSucceeded
+	pods := []core.Pod{
+		// pods of the database and of unrelated workloads are both charged by the quota
+		*newPod("demo", "pg-0", "1", "512Mi"),
+		*newPod("demo", "web", "500m", "512Mi"),
+		done,
+		// no quota for namespaces without the selected kinds
+		*newPod(metav1.NamespaceSystem, "coredns", "100m", "70Mi"),
+	}
+	sc := "standard"
+	pvcs := []core.PersistentVolumeClaim{{}, {}}
+	pvcs[1].Namespace = "monitoring"
+	pvcs[1].Spec.Resources.Requests = core.ResourceList{core.ResourceStorage: resource.MustParse("5Gi")}
+	pvcs[0].Namespace = "demo"
+	pvcs[0].Spec.StorageClassName = &sc
+	pvcs[0].Spec.Resources.Requests = core.ResourceList{core.ResourceStorage: resource.MustParse("10Gi")}
+	resourceOf := func(gk schema.GroupKind) (string, bool) {
+		return "postgreses", gk.Kind == "Postgres"
+	}
+
+	quotas := RecommendQuotas("budget", []v1alpha1.GenericResource{pg}, pods, pvcs, 0, resourceOf)
+	if len(quotas) != 1 {
+		t.Fatalf("got %d quotas, want 1", len(quotas))
+	}
+	hard := quotas[0].Spec.Hard
+	want := map[core.ResourceName]string{
+		core.ResourceRequestsCPU:      "1500m",
+		core.ResourceRequestsMemory:   "1Gi",
+		core.ResourceRequestsStorage:  "10Gi",
+		storageClassQuota(sc):         "10Gi",
+		"count/postgreses.kubedb.com": "1",
+	}
+	if len(hard) != len(want) {
+		t.Errorf("hard = %v", hard)
+	}
+	for name, v := range want {
+		if q, ok := hard[name]; !ok || q.Cmp(resource.MustParse(v)) != 0 {
+			t.Errorf("%s: got %v, want %s", name, hard[name], v)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := printQuotaYAML(&buf, append(quotas, quotas[0])); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); strings.Count(out, "kind: ResourceQuota") != 2 || !strings.Contains(out, "\n---\n") {
+		t.Errorf("got %q", out)
+	}
+}
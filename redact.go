@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// RedactOptions configures the --redact mode used to produce reports that can be
+// shared with vendors or support.
+type RedactOptions struct {
+	Enabled bool
+	Salt    string
+}
+
+func (o *RedactOptions) AddFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Enabled, "redact", false, "Replace namespaces, names, UIDs and label values with salted hashes and drop annotations, emails, IPs and DNS names")
+	fs.StringVar(&o.Salt, "redact-salt", "", "Secret salt used to hash identifiers in --redact mode. Defaults to a random salt printed to stderr; reuse it to keep hashes stable across runs.")
+}
+
+// NewRedactor returns nil if redaction is disabled. A nil *Redactor returns its input unchanged.
+// The salt must stay secret: anything shipped in the report, like the cluster UID,
+// would let the receiver brute force the hashed names.
+func (o RedactOptions) NewRedactor() (*Redactor, error) {
+	if !o.Enabled {
+		return nil, nil
+	}
+	salt := o.Salt
+	if salt == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		salt = hex.EncodeToString(b)
+		_, _ = fmt.Fprintf(os.Stderr, "redact salt: %s (pass --redact-salt=%s to reproduce the hashes)\n", salt, salt)
+	}
+	return &Redactor{salt: []byte(salt)}, nil
+}
+
+// Redactor replaces identifiers with stable salted hashes. The same input always
+// maps to the same output for a given salt, so redacted reports can still be
+// joined and compared. Aggregate numbers and kinds are never changed.
+type Redactor struct {
+	salt []byte
+}
+
+func (r *Redactor) Hash(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	mac := hmac.New(sha256.New, r.salt)
+	_, _ = mac.Write([]byte(s))
+	return "x-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+func (r *Redactor) KubernetesInfo(ki *v1alpha1.KubernetesInfo) *v1alpha1.KubernetesInfo {
+	if r == nil || ki == nil {
+		return ki
+	}
+	out := *ki
+	out.ClusterName = r.Hash(ki.ClusterName)
+	out.ClusterUID = r.Hash(ki.ClusterUID)
+	if ki.ControlPlane != nil {
+		out.ControlPlane = &v1alpha1.ControlPlaneInfo{
+			NotBefore: ki.ControlPlane.NotBefore,
+			NotAfter:  ki.ControlPlane.NotAfter,
+		}
+	}
+	return &out
+}
+
+func (r *Redactor) ObjectMeta(in metav1.ObjectMeta) metav1.ObjectMeta {
+	if r == nil {
+		return in
+	}
+	out := metav1.ObjectMeta{
+		Name:                       r.Hash(in.Name),
+		Namespace:                  r.Hash(in.Namespace),
+		UID:                        types.UID(r.Hash(string(in.UID))),
+		ResourceVersion:            in.ResourceVersion,
+		Generation:                 in.Generation,
+		CreationTimestamp:          in.CreationTimestamp,
+		DeletionTimestamp:          in.DeletionTimestamp,
+		DeletionGracePeriodSeconds: in.DeletionGracePeriodSeconds,
+		Finalizers:                 in.Finalizers,
+		ClusterName:                r.Hash(in.ClusterName),
+	}
+	if len(in.Labels) > 0 {
+		out.Labels = make(map[string]string, len(in.Labels))
+		for k, v := range in.Labels {
+			out.Labels[k] = r.Hash(v)
+		}
+	}
+	for _, ref := range in.OwnerReferences {
+		ref.Name = r.Hash(ref.Name)
+		ref.UID = types.UID(r.Hash(string(ref.UID)))
+		out.OwnerReferences = append(out.OwnerReferences, ref)
+	}
+	return out
+}
+
+func (r *Redactor) GenericResource(in *v1alpha1.GenericResource) *v1alpha1.GenericResource {
+	if r == nil || in == nil {
+		return in
+	}
+	out := *in
+	out.ObjectMeta = r.ObjectMeta(in.ObjectMeta)
+	// status messages are free text that often names the object, its namespace or pods
+	out.Status.Message = r.Hash(in.Status.Message)
+	out.Status.Conditions = nil
+	for _, cond := range in.Status.Conditions {
+		cond.Message = r.Hash(cond.Message)
+		out.Status.Conditions = append(out.Status.Conditions, cond)
+	}
+	return &out
+}
+
+func (r *Redactor) StorageOwner(in StorageOwner) StorageOwner {
+	if r == nil {
+		return in
+	}
+	in.Namespace = r.Hash(in.Namespace)
+	in.Name = r.Hash(in.Name)
+	return in
+}
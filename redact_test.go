@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+)
+
+func TestNewRedactor(t *testing.T) {
+	if r, err := (RedactOptions{}).NewRedactor(); err != nil || r != nil {
+		t.Fatalf("disabled: got %v, %v", r, err)
+	}
+
+	a, err := RedactOptions{Enabled: true}.NewRedactor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := RedactOptions{Enabled: true}.NewRedactor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Hash("demo") == b.Hash("demo") {
+		t.Error("generated salts must differ between runs")
+	}
+
+	c, _ := RedactOptions{Enabled: true, Salt: "s"}.NewRedactor()
+	d, _ := RedactOptions{Enabled: true, Salt: "s"}.NewRedactor()
+	if c.Hash("demo") != d.Hash("demo") {
+		t.Error("hashes must be stable for the same salt")
+	}
+}
+
+func TestRedactorHash(t *testing.T) {
+	var nilRedactor *Redactor
+	if got := nilRedactor.Hash("demo"); got != "demo" {
+		t.Errorf("nil redactor changed input: %q", got)
+	}
+	r := &Redactor{salt: []byte("s")}
+	if got := r.Hash(""); got != "" {
+		t.Errorf("empty input hashed to %q", got)
+	}
+	if got := r.Hash("demo"); !strings.HasPrefix(got, "x-") || len(got) != 14 || got == r.Hash("demo2") {
+		t.Errorf("unexpected hash %q", got)
+	}
+}
+
+func TestRedactorObjectMeta(t *testing.T) {
+	r := &Redactor{salt: []byte("s")}
+	in := metav1.ObjectMeta{
+		Namespace:       "demo",
+		Name:            "pg",
+		UID:             "uid",
+		Labels:          map[string]string{"app": "pg"},
+		Annotations:     map[string]string{"secret": "value"},
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Postgres", Name: "pg", UID: "owner"}},
+		Generation:      3,
+	}
+	out := r.ObjectMeta(in)
+	if out.Namespace != r.Hash("demo") || out.Name != r.Hash("pg") || string(out.UID) != r.Hash("uid") {
+		t.Errorf("identifiers not hashed: %+v", out)
+	}
+	if out.Labels["app"] != r.Hash("pg") {
+		t.Errorf("label value not hashed: %v", out.Labels)
+	}
+	if out.Annotations != nil {
+		t.Errorf("annotations not dropped: %v", out.Annotations)
+	}
+	if ref := out.OwnerReferences[0]; ref.Kind != "Postgres" || ref.Name != r.Hash("pg") {
+		t.Errorf("owner reference: %+v", ref)
+	}
+	if out.Generation != 3 {
+		t.Errorf("generation changed: %d", out.Generation)
+	}
+}
+
+func TestRedactorKubernetesInfo(t *testing.T) {
+	r := &Redactor{salt: []byte("s")}
+	ki := testKubernetesInfo()
+	ki.ControlPlane = &v1alpha1.ControlPlaneInfo{DNSNames: []string{"api.example.com"}, IPAddresses: []string{"10.0.0.1"}}
+	out := r.KubernetesInfo(ki)
+	if out.ClusterUID == ki.ClusterUID || out.ClusterName == ki.ClusterName {
+		t.Errorf("cluster identity not hashed: %+v", out)
+	}
+	if len(out.ControlPlane.DNSNames) != 0 || len(out.ControlPlane.IPAddresses) != 0 {
+		t.Errorf("control plane details not dropped: %+v", out.ControlPlane)
+	}
+	if ki.ClusterUID != "cluster-uid" {
+		t.Error("input modified")
+	}
+}
+
+func TestRedactorGenericResource(t *testing.T) {
+	r := &Redactor{salt: []byte("s")}
+	in := newGenericResource("Postgres.kubedb.com", "demo", "pg", "1", "")
+	in.Status.Status = status.InProgressStatus
+	in.Status.Message = "Postgres demo/pg is not ready"
+	in.Status.Conditions = []status.Condition{{Type: status.ConditionReconciling, Status: core.ConditionTrue, Reason: "PodsNotReady", Message: "pod pg-0 in demo is pending"}}
+
+	out := r.GenericResource(&in)
+	if out.Name != r.Hash("pg") || out.Status.Status != status.InProgressStatus {
+		t.Errorf("got %+v", out)
+	}
+	if out.Status.Message != r.Hash(in.Status.Message) {
+		t.Errorf("message not hashed: %q", out.Status.Message)
+	}
+	cond := out.Status.Conditions[0]
+	if cond.Message != r.Hash("pod pg-0 in demo is pending") || cond.Reason != "PodsNotReady" || cond.Type != status.ConditionReconciling {
+		t.Errorf("condition = %+v", cond)
+	}
+	if in.Status.Conditions[0].Message != "pod pg-0 in demo is pending" {
+		t.Error("input modified")
+	}
+}
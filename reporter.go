@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	"github.com/tamalsaha/resource-listing-summary/crds"
+	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/errors"
+	"kmodules.xyz/client-go/apiextensions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// installCRDs creates or updates the ResourceSummary CRD and waits until it is served.
+func installCRDs(client crd_cs.Interface) error {
+	return apiextensions.RegisterCRDs(client, []*apiextensions.CustomResourceDefinition{
+		crds.MustCustomResourceDefinition(v1alpha1.SchemeGroupVersion.WithResource(v1alpha1.ResourceResourceSummaries)),
+	})
+}
+
+// resourceSummaryName returns the object name for a resource type, eg, postgres.v1alpha2.kubedb.com
+func resourceSummaryName(gvk schema.GroupVersionKind) string {
+	name := strings.ToLower(gvk.Kind + "." + gvk.Version)
+	if gvk.Group != "" {
+		name += "." + gvk.Group
+	}
+	return name
+}
+
+// summarizeByNamespace splits the report into one summary per resource type and namespace.
+// Kinds counted from metadata only have counts, but no replicas or resources.
+func summarizeByNamespace(report *Report) map[schema.GroupVersionKind]map[string]*v1alpha1.ResourceSummarySpec {
+	out := map[schema.GroupVersionKind]map[string]*v1alpha1.ResourceSummarySpec{}
+	get := func(gvk schema.GroupVersionKind, ns string) *v1alpha1.ResourceSummarySpec {
+		if out[gvk] == nil {
+			out[gvk] = map[string]*v1alpha1.ResourceSummarySpec{}
+		}
+		spec, ok := out[gvk][ns]
+		if !ok {
+			spec = &v1alpha1.ResourceSummarySpec{APIGroup: gvk.Group, Kind: gvk.Kind}
+			out[gvk][ns] = spec
+		}
+		return spec
+	}
+
+	modes := map[schema.GroupVersionKind]map[string]map[string]*v1alpha1.ModeSummary{}
+	for _, obj := range report.Objects {
+		gvk := schema.GroupVersionKind{Group: obj.Spec.Group, Version: obj.Spec.Version, Kind: obj.Spec.Kind}
+		if modes[gvk] == nil {
+			modes[gvk] = map[string]map[string]*v1alpha1.ModeSummary{}
+		}
+		if modes[gvk][obj.Namespace] == nil {
+			modes[gvk][obj.Namespace] = map[string]*v1alpha1.ModeSummary{}
+		}
+		spec := get(gvk, obj.Namespace)
+		spec.Count++
+		addToSummary(spec, modes[gvk][obj.Namespace], obj.Spec)
+	}
+	for gvk, byNs := range modes {
+		for ns, m := range byNs {
+			setModes(out[gvk][ns], m)
+		}
+	}
+
+	for gvk, counts := range report.Namespaces {
+		if !report.MetadataOnly[gvk] {
+			continue
+		}
+		for ns, n := range counts {
+			get(gvk, ns).Count = n
+		}
+	}
+	return out
+}
+
+// reporter periodically writes the summaries of the selected types as ResourceSummary objects.
+type reporter struct {
+	c         client.Client
+	ki        *v1alpha1.KubernetesInfo
+	gvks      []schema.GroupVersionKind
+	resources map[schema.GroupVersionKind]metav1.APIResource
+	// namespace of the summaries of cluster scoped types
+	namespace string
+	opts      CalculateOptions
+	interval  time.Duration
+}
+
+// Start implements manager.Runnable. It runs only while the manager holds the leader lease.
+func (rep *reporter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(rep.interval)
+	defer ticker.Stop()
+	for {
+		if err := rep.report(ctx); err != nil && ctx.Err() == nil {
+			setupLog.Error(err, "failed to write resource summaries")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// gvkError returns why the summaries of a type could not be computed this run, if any.
+func gvkError(report *Report, gvk schema.GroupVersionKind) error {
+	if err := report.Errors[gvk]; err != nil {
+		return err
+	}
+	if report.Incomplete[gvk] {
+		return fmt.Errorf("listing %s did not finish", gvk)
+	}
+	if access, checked := report.Access[gvk]; checked {
+		if !access.Allowed() {
+			return fmt.Errorf("no permission to list %s", gvk)
+		}
+		if !access.ClusterWide {
+			return fmt.Errorf("%s is listed only in the accessible namespaces", gvk)
+		}
+	}
+	return nil
+}
+
+func (rep *reporter) report(ctx context.Context) error {
+	report, err := collect(ctx, rep.c, rep.ki, rep.gvks, nil, rep.opts)
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+	summaries := summarizeByNamespace(report)
+
+	var errs []error
+	for _, gvk := range rep.gvks {
+		if err := rep.sync(ctx, gvk, summaries[gvk], gvkError(report, gvk), now); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", gvk, err))
+		}
+	}
+	return errors.NewAggregate(errs)
+}
+
+// sync upserts the summaries of one type and deletes the ones of namespaces without objects.
+// If the type could not be listed, the existing summaries keep their spec and only get the error
+// until a later run lists the type again.
+func (rep *reporter) sync(ctx context.Context, gvk schema.GroupVersionKind, summaries map[string]*v1alpha1.ResourceSummarySpec, gvkErr error, now metav1.Time) error {
+	var existing v1alpha1.ResourceSummaryList
+	if err := rep.c.List(ctx, &existing, client.MatchingLabels(GVKLabels(gvk, nil))); err != nil {
+		return err
+	}
+
+	if gvkErr != nil {
+		for i := range existing.Items {
+			obj := &existing.Items[i]
+			obj.Status.Errors = []string{gvkErr.Error()}
+			if err := rep.c.Status().Update(ctx, obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	res, found := rep.resources[gvk]
+	var lbls map[string]string
+	if found {
+		lbls = GVKLabels(gvk, &res)
+	} else {
+		lbls = GVKLabels(gvk, nil)
+	}
+
+	keep := map[string]bool{}
+	nsList := make([]string, 0, len(summaries))
+	for ns := range summaries {
+		nsList = append(nsList, ns)
+	}
+	sort.Strings(nsList)
+	for _, ns := range nsList {
+		target := ns
+		if target == "" {
+			target = rep.namespace
+		}
+		keep[target] = true
+		if err := rep.upsert(ctx, target, resourceSummaryName(gvk), lbls, *summaries[ns], now); err != nil {
+			return err
+		}
+	}
+	for i := range existing.Items {
+		obj := &existing.Items[i]
+		if keep[obj.Namespace] {
+			continue
+		}
+		if err := rep.c.Delete(ctx, obj); err != nil && !kerr.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rep *reporter) upsert(ctx context.Context, ns, name string, lbls map[string]string, spec v1alpha1.ResourceSummarySpec, now metav1.Time) error {
+	var obj v1alpha1.ResourceSummary
+	err := rep.c.Get(ctx, client.ObjectKey{Namespace: ns, Name: name}, &obj)
+	if kerr.IsNotFound(err) {
+		obj = v1alpha1.ResourceSummary{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns,
+				Name:      name,
+				Labels:    lbls,
+			},
+			Spec: spec,
+		}
+		err = rep.c.Create(ctx, &obj)
+	} else if err == nil {
+		obj.Labels = lbls
+		obj.Spec = spec
+		err = rep.c.Update(ctx, &obj)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the status subresource ignores the status sent with create and update.
+	// A successful run drops the errors recorded by the failed runs before it.
+	obj.Status.LastComputedTime = &now
+	obj.Status.Errors = nil
+	return rep.c.Status().Update(ctx, &obj)
+}
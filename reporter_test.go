@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func listSummaries(t *testing.T, c client.Client) map[string]v1alpha1.ResourceSummary {
+	t.Helper()
+	var list v1alpha1.ResourceSummaryList
+	if err := c.List(context.TODO(), &list); err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]v1alpha1.ResourceSummary{}
+	for _, obj := range list.Items {
+		out[obj.Namespace+"/"+obj.Name] = obj
+	}
+	return out
+}
+
+func TestReporterSync(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	rep := &reporter{c: c, namespace: "kube-system"}
+	name := resourceSummaryName(testPostgres)
+	now := metav1.NewTime(time.Date(2021, 11, 1, 10, 0, 0, 0, time.UTC))
+
+	spec := func(count int) *v1alpha1.ResourceSummarySpec {
+		return &v1alpha1.ResourceSummarySpec{APIGroup: testPostgres.Group, Kind: testPostgres.Kind, Count: count}
+	}
+	if err := rep.sync(context.TODO(), testPostgres, map[string]*v1alpha1.ResourceSummarySpec{"demo": spec(2), "prod": spec(1)}, nil, now); err != nil {
+		t.Fatal(err)
+	}
+	got := listSummaries(t, c)
+	if len(got) != 2 || got["demo/"+name].Spec.Count != 2 || got["prod/"+name].Status.LastComputedTime == nil {
+		t.Fatalf("got %+v", got)
+	}
+	if got["demo/"+name].Labels["k8s.io/group"] != "kubedb.com" {
+		t.Errorf("labels = %v", got["demo/"+name].Labels)
+	}
+
+	// a failed run keeps the last computed numbers and records the error
+	if err := rep.sync(context.TODO(), testPostgres, nil, errors.New("connection refused"), now); err != nil {
+		t.Fatal(err)
+	}
+	got = listSummaries(t, c)
+	if len(got) != 2 || got["demo/"+name].Spec.Count != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	for key, obj := range got {
+		if len(obj.Status.Errors) != 1 || obj.Status.Errors[0] != "connection refused" {
+			t.Errorf("%s: errors = %q", key, obj.Status.Errors)
+		}
+	}
+
+	// once the type is listed again, its errors are cleared and empty namespaces are deleted
+	later := metav1.NewTime(now.Add(time.Minute))
+	if err := rep.sync(context.TODO(), testPostgres, map[string]*v1alpha1.ResourceSummarySpec{"demo": spec(3)}, nil, later); err != nil {
+		t.Fatal(err)
+	}
+	got = listSummaries(t, c)
+	obj, found := got["demo/"+name]
+	if len(got) != 1 || !found || obj.Spec.Count != 3 {
+		t.Fatalf("got %+v", got)
+	}
+	if len(obj.Status.Errors) != 0 || !obj.Status.LastComputedTime.Equal(&later) {
+		t.Errorf("status = %+v", obj.Status)
+	}
+}
+
+func TestGVKError(t *testing.T) {
+	report := newMarkedReport(4)
+	report.Errors = map[schema.GroupVersionKind]error{testWidgets: errors.New("the server is currently unable to handle the request")}
+	tests := map[schema.GroupVersionKind]string{
+		testPods:     "listing /v1, Kind=Pod did not finish",
+		testPostgres: "kubedb.com/v1alpha2, Kind=Postgres is listed only in the accessible namespaces",
+		testMySQL:    "no permission to list kubedb.com/v1alpha2, Kind=MySQL",
+		testWidgets:  "the server is currently unable to handle the request",
+		testMongoDB:  "",
+	}
+	for gvk, want := range tests {
+		var got string
+		if err := gvkError(report, gvk); err != nil {
+			got = err.Error()
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", gvk.Kind, got, want)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const noneValue = "<none>"
+
+// StorageOwner identifies the top level object (workload or database CR)
+// a PersistentVolumeClaim belongs to.
+type StorageOwner struct {
+	APIGroup  string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (o StorageOwner) String() string {
+	if o.Kind == "" {
+		return noneValue
+	}
+	return schema.GroupKind{Group: o.APIGroup, Kind: o.Kind}.String() + "/" + o.Name
+}
+
+// StorageUsage is the requested and provisioned capacity of a set of claims.
+// A PersistentVolume is counted once, against the claim it is bound to.
+type StorageUsage struct {
+	Claims      int
+	Volumes     int
+	Requested   resource.Quantity
+	Provisioned resource.Quantity
+}
+
+func (u *StorageUsage) Add(claims, volumes int, requested, provisioned *resource.Quantity) {
+	u.Claims += claims
+	u.Volumes += volumes
+	u.Requested.Add(*requested)
+	u.Provisioned.Add(*provisioned)
+}
+
+type storageClassKey struct {
+	StorageClass string
+	Namespace    string
+	// volumes bound to claims that could not be listed
+	Unattributed bool
+}
+
+type storageOwnerKey struct {
+	Owner        StorageOwner
+	StorageClass string
+}
+
+// ownerResolver walks the controller references of intermediate workloads
+// (eg, StatefulSet -> Postgres, ReplicaSet -> Deployment) up to the top level owner.
+type ownerResolver struct {
+	parents map[StorageOwner]StorageOwner
+}
+
+func newOwnerResolver() *ownerResolver {
+	return &ownerResolver{parents: map[StorageOwner]StorageOwner{}}
+}
+
+func (r *ownerResolver) Add(obj metav1.Object, gk schema.GroupKind) {
+	ref := metav1.GetControllerOf(obj)
+	if ref == nil {
+		return
+	}
+	self := StorageOwner{APIGroup: gk.Group, Kind: gk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	r.parents[self] = refToOwner(obj.GetNamespace(), *ref)
+}
+
+func (r *ownerResolver) Resolve(owner StorageOwner) StorageOwner {
+	for i := 0; i < 5; i++ {
+		parent, ok := r.parents[owner]
+		if !ok {
+			break
+		}
+		owner = parent
+	}
+	return owner
+}
+
+func refToOwner(ns string, ref metav1.OwnerReference) StorageOwner {
+	gv, _ := schema.ParseGroupVersion(ref.APIVersion)
+	return StorageOwner{APIGroup: gv.Group, Kind: ref.Kind, Namespace: ns, Name: ref.Name}
+}
+
+// StorageReport is the storage usage grouped by storage class and namespace, and by owner.
+type StorageReport struct {
+	ByClass map[storageClassKey]*StorageUsage
+	ByOwner map[storageOwnerKey]*StorageUsage
+	Total   StorageUsage
+	// claims could not be listed, bound volumes are reported without namespace and owner
+	NoClaimAccess bool
+}
+
+func calculateStorage(ctx context.Context, c client.Client, r *Redactor) error {
+	report, err := collectStorage(ctx, c)
+	if err != nil {
+		return err
+	}
+	return printStorage(os.Stdout, report, r)
+}
+
+func collectStorage(ctx context.Context, c client.Client) (*StorageReport, error) {
+	var pvcs core.PersistentVolumeClaimList
+	pvcErr := c.List(ctx, &pvcs)
+	if pvcErr != nil && !kerr.IsForbidden(pvcErr) {
+		return nil, pvcErr
+	}
+	// volumes and workloads are only used to attribute claims, so they are skipped if not readable
+	var pvs core.PersistentVolumeList
+	if err := c.List(ctx, &pvs); err != nil && !kerr.IsForbidden(err) {
+		return nil, err
+	}
+	var stsList apps.StatefulSetList
+	if err := c.List(ctx, &stsList); err != nil && !kerr.IsForbidden(err) {
+		return nil, err
+	}
+	var rsList apps.ReplicaSetList
+	if err := c.List(ctx, &rsList); err != nil && !kerr.IsForbidden(err) {
+		return nil, err
+	}
+	var pods core.PodList
+	if err := c.List(ctx, &pods); err != nil && !kerr.IsForbidden(err) {
+		return nil, err
+	}
+
+	resolver := newOwnerResolver()
+	for i := range stsList.Items {
+		resolver.Add(&stsList.Items[i], apps.SchemeGroupVersion.WithKind("StatefulSet").GroupKind())
+	}
+	for i := range rsList.Items {
+		resolver.Add(&rsList.Items[i], apps.SchemeGroupVersion.WithKind("ReplicaSet").GroupKind())
+	}
+
+	// claims created from StatefulSet volumeClaimTemplates are named <template>-<sts>-<ordinal>
+	// and usually carry no owner reference
+	claimOwners := map[client.ObjectKey]StorageOwner{}
+	for _, pod := range pods.Items {
+		owner := StorageOwner{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name}
+		if ref := metav1.GetControllerOf(&pod); ref != nil {
+			owner = refToOwner(pod.Namespace, *ref)
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if vol.PersistentVolumeClaim != nil {
+				claimOwners[client.ObjectKey{Namespace: pod.Namespace, Name: vol.PersistentVolumeClaim.ClaimName}] = owner
+			}
+		}
+	}
+	stsOwner := func(pvc core.PersistentVolumeClaim) (StorageOwner, bool) {
+		for _, sts := range stsList.Items {
+			if sts.Namespace != pvc.Namespace {
+				continue
+			}
+			for _, vct := range sts.Spec.VolumeClaimTemplates {
+				prefix := vct.Name + "-" + sts.Name + "-"
+				if strings.HasPrefix(pvc.Name, prefix) && isOrdinal(strings.TrimPrefix(pvc.Name, prefix)) {
+					return StorageOwner{APIGroup: apps.GroupName, Kind: "StatefulSet", Namespace: sts.Namespace, Name: sts.Name}, true
+				}
+			}
+		}
+		return StorageOwner{}, false
+	}
+
+	pvMap := make(map[string]core.PersistentVolume, len(pvs.Items))
+	for _, pv := range pvs.Items {
+		pvMap[pv.Name] = pv
+	}
+	claimedPVs := map[string]bool{}
+
+	report := &StorageReport{
+		ByClass:       map[storageClassKey]*StorageUsage{},
+		ByOwner:       map[storageOwnerKey]*StorageUsage{},
+		NoClaimAccess: pvcErr != nil,
+	}
+	byClass, byOwner, total := report.ByClass, report.ByOwner, &report.Total
+
+	for _, pvc := range pvcs.Items {
+		var owner StorageOwner
+		if ref := metav1.GetControllerOf(&pvc); ref != nil {
+			owner = refToOwner(pvc.Namespace, *ref)
+		} else if o, ok := stsOwner(pvc); ok {
+			owner = o
+		} else if o, ok := claimOwners[client.ObjectKey{Namespace: pvc.Namespace, Name: pvc.Name}]; ok {
+			owner = o
+		}
+		owner = resolver.Resolve(owner)
+
+		storageClass := ""
+		if pvc.Spec.StorageClassName != nil {
+			storageClass = *pvc.Spec.StorageClassName
+		}
+		requested := pvc.Spec.Resources.Requests.Storage()
+		provisioned := pvc.Status.Capacity.Storage()
+		volumes := 0
+		if pv, ok := pvMap[pvc.Spec.VolumeName]; ok && pvc.Spec.VolumeName != "" {
+			claimedPVs[pv.Name] = true
+			volumes = 1
+			provisioned = pv.Spec.Capacity.Storage()
+			if storageClass == "" {
+				storageClass = pv.Spec.StorageClassName
+			}
+		}
+		if storageClass == "" {
+			storageClass = noneValue
+		}
+
+		ck := storageClassKey{StorageClass: storageClass, Namespace: pvc.Namespace}
+		if byClass[ck] == nil {
+			byClass[ck] = &StorageUsage{}
+		}
+		byClass[ck].Add(1, volumes, requested, provisioned)
+
+		okey := storageOwnerKey{Owner: owner, StorageClass: storageClass}
+		if owner.Kind == "" {
+			okey.Owner.Namespace = pvc.Namespace
+		}
+		if byOwner[okey] == nil {
+			byOwner[okey] = &StorageUsage{}
+		}
+		byOwner[okey].Add(1, volumes, requested, provisioned)
+
+		total.Add(1, volumes, requested, provisioned)
+	}
+
+	// volumes not bound to any listed claim (eg, Available or Released) are reported as cluster scoped.
+	// Without access to the claims, the bound ones are kept apart, since their claims are unknown.
+	for _, pv := range pvs.Items {
+		if claimedPVs[pv.Name] {
+			continue
+		}
+		storageClass := pv.Spec.StorageClassName
+		if storageClass == "" {
+			storageClass = noneValue
+		}
+		ck := storageClassKey{StorageClass: storageClass, Unattributed: report.NoClaimAccess && pv.Spec.ClaimRef != nil}
+		if byClass[ck] == nil {
+			byClass[ck] = &StorageUsage{}
+		}
+		byClass[ck].Add(0, 1, resource.NewQuantity(0, resource.BinarySI), pv.Spec.Capacity.Storage())
+		total.Add(0, 1, resource.NewQuantity(0, resource.BinarySI), pv.Spec.Capacity.Storage())
+	}
+
+	return report, nil
+}
+
+func printStorage(out io.Writer, report *StorageReport, r *Redactor) error {
+	byClass, byOwner, total := report.ByClass, report.ByOwner, report.Total
+
+	classKeys := make([]storageClassKey, 0, len(byClass))
+	for k := range byClass {
+		classKeys = append(classKeys, k)
+	}
+	sort.Slice(classKeys, func(i, j int) bool {
+		if classKeys[i].StorageClass != classKeys[j].StorageClass {
+			return classKeys[i].StorageClass < classKeys[j].StorageClass
+		}
+		if classKeys[i].Namespace != classKeys[j].Namespace {
+			return classKeys[i].Namespace < classKeys[j].Namespace
+		}
+		return !classKeys[i].Unattributed && classKeys[j].Unattributed
+	})
+
+	ownerKeys := make([]storageOwnerKey, 0, len(byOwner))
+	for k := range byOwner {
+		ownerKeys = append(ownerKeys, k)
+	}
+	sort.Slice(ownerKeys, func(i, j int) bool {
+		if ownerKeys[i].Owner.Namespace != ownerKeys[j].Owner.Namespace {
+			return ownerKeys[i].Owner.Namespace < ownerKeys[j].Owner.Namespace
+		}
+		if ownerKeys[i].Owner.String() != ownerKeys[j].Owner.String() {
+			return ownerKeys[i].Owner.String() < ownerKeys[j].Owner.String()
+		}
+		return ownerKeys[i].StorageClass < ownerKeys[j].StorageClass
+	})
+
+	const padding = 3
+	w := tabwriter.NewWriter(out, 0, 0, padding, ' ', tabwriter.TabIndent)
+	if report.NoClaimAccess {
+		_, _ = fmt.Fprintln(w, "PERSISTENT VOLUME CLAIMS:\tno access, bound volumes are not attributed to namespaces and owners")
+		_, _ = fmt.Fprintln(w, "")
+	}
+	_, _ = fmt.Fprintln(w, "STORAGE CLASS\tNAMESPACE\tCLAIMS\tVOLUMES\tREQUESTED\tPROVISIONED\t")
+	for _, k := range classKeys {
+		u := byClass[k]
+		ns, claims, requested := r.Hash(k.Namespace), strconv.Itoa(u.Claims), u.Requested.String()
+		if k.Unattributed {
+			ns, claims, requested = "no access", "-", "-"
+		} else if ns == "" {
+			ns = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t\n", k.StorageClass, ns, claims, u.Volumes, requested, u.Provisioned.String())
+	}
+	claims, requested := strconv.Itoa(total.Claims), total.Requested.String()
+	if report.NoClaimAccess {
+		claims, requested = "-", "-"
+	}
+	_, _ = fmt.Fprintf(w, "TOTAL\t=\t%s\t%d\t%s\t%s\t\n", claims, total.Volumes, requested, total.Provisioned.String())
+	_, _ = fmt.Fprintln(w, "")
+
+	_, _ = fmt.Fprintln(w, "NAMESPACE\tOWNER\tSTORAGE CLASS\tCLAIMS\tREQUESTED\tPROVISIONED\t")
+	if report.NoClaimAccess {
+		_, _ = fmt.Fprintln(w, "no access\t\t\t\t\t\t")
+	}
+	for _, k := range ownerKeys {
+		u := byOwner[k]
+		owner := r.StorageOwner(k.Owner)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t\n", owner.Namespace, owner, k.StorageClass, u.Claims, u.Requested.String(), u.Provisioned.String())
+	}
+	return w.Flush()
+}
+
+func isOrdinal(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func newClaim(ns, name, class, volume, size string) *core.PersistentVolumeClaim {
+	pvc := &core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+		Spec: core.PersistentVolumeClaimSpec{
+			VolumeName: volume,
+			Resources: core.ResourceRequirements{
+				Requests: core.ResourceList{core.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+	}
+	if class != "" {
+		pvc.Spec.StorageClassName = pointer.StringPtr(class)
+	}
+	return pvc
+}
+
+func newVolume(name, class, size string) *core.PersistentVolume {
+	return &core.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: core.PersistentVolumeSpec{
+			StorageClassName: class,
+			Capacity:         core.ResourceList{core.ResourceStorage: resource.MustParse(size)},
+		},
+	}
+}
+
+func checkUsage(t *testing.T, name string, u *StorageUsage, claims, volumes int, requested, provisioned string) {
+	t.Helper()
+	if u == nil {
+		t.Fatalf("%s: missing", name)
+	}
+	if u.Claims != claims || u.Volumes != volumes ||
+		u.Requested.Cmp(resource.MustParse(requested)) != 0 || u.Provisioned.Cmp(resource.MustParse(provisioned)) != 0 {
+		t.Errorf("%s: got claims=%d volumes=%d requested=%s provisioned=%s, want %d %d %s %s",
+			name, u.Claims, u.Volumes, u.Requested.String(), u.Provisioned.String(), claims, volumes, requested, provisioned)
+	}
+}
+
+func TestCollectStorage(t *testing.T) {
+	controller := func(apiVersion, kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: pointer.BoolPtr(true)}}
+	}
+	sts := &apps.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "pg", OwnerReferences: controller("kubedb.com/v1alpha2", "Postgres", "pg")},
+		Spec: apps.StatefulSetSpec{
+			VolumeClaimTemplates: []core.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "data"}}},
+		},
+	}
+	pod := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web-abc", OwnerReferences: controller("apps/v1", "ReplicaSet", "web-123")},
+		Spec: core.PodSpec{Volumes: []core.Volume{{
+			Name:         "cache",
+			VolumeSource: core.VolumeSource{PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: "cache"}},
+		}}},
+	}
+	rs := &apps.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web-123", OwnerReferences: controller("apps/v1", "Deployment", "web")}}
+
+	c := newTestClient(t,
+		sts, pod, rs,
+		// claims of the StatefulSet template, bound to larger volumes
+		newClaim("demo", "data-pg-0", "standard", "pv-0", "10Gi"),
+		newClaim("demo", "data-pg-1", "standard", "pv-1", "10Gi"),
+		newVolume("pv-0", "standard", "12Gi"),
+		newVolume("pv-1", "standard", "12Gi"),
+		// claim mounted by a pod of a Deployment, storage class taken from the volume
+		newClaim("demo", "cache", "", "pv-2", "1Gi"),
+		newVolume("pv-2", "fast", "1Gi"),
+		// claim without owner and volume, and a released volume
+		newClaim("other", "orphan", "", "", "2Gi"),
+		newVolume("released", "standard", "5Gi"),
+	)
+
+	report, err := collectStorage(context.TODO(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUsage(t, "total", &report.Total, 4, 4, "23Gi", "30Gi")
+	checkUsage(t, "standard/demo", report.ByClass[storageClassKey{StorageClass: "standard", Namespace: "demo"}], 2, 2, "20Gi", "24Gi")
+	checkUsage(t, "fast/demo", report.ByClass[storageClassKey{StorageClass: "fast", Namespace: "demo"}], 1, 1, "1Gi", "1Gi")
+	checkUsage(t, "none/other", report.ByClass[storageClassKey{StorageClass: noneValue, Namespace: "other"}], 1, 0, "2Gi", "0")
+	checkUsage(t, "standard/released", report.ByClass[storageClassKey{StorageClass: "standard"}], 0, 1, "0", "5Gi")
+
+	postgres := StorageOwner{APIGroup: "kubedb.com", Kind: "Postgres", Namespace: "demo", Name: "pg"}
+	checkUsage(t, "owner postgres", report.ByOwner[storageOwnerKey{Owner: postgres, StorageClass: "standard"}], 2, 2, "20Gi", "24Gi")
+	deployment := StorageOwner{APIGroup: "apps", Kind: "Deployment", Namespace: "demo", Name: "web"}
+	checkUsage(t, "owner deployment", report.ByOwner[storageOwnerKey{Owner: deployment, StorageClass: "fast"}], 1, 1, "1Gi", "1Gi")
+	checkUsage(t, "no owner", report.ByOwner[storageOwnerKey{Owner: StorageOwner{Namespace: "other"}, StorageClass: noneValue}], 1, 0, "2Gi", "0")
+
+	var buf bytes.Buffer
+	if err := printStorage(&buf, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "Postgres.kubedb.com/pg") || !strings.Contains(out, "TOTAL") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestIsOrdinal(t *testing.T) {
+	for s, want := range map[string]bool{"0": true, "12": true, "": false, "1a": false, "-1": false} {
+		if got := isOrdinal(s); got != want {
+			t.Errorf("isOrdinal(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestCollectStorageNoClaimAccess(t *testing.T) {
+	bound := newVolume("pv-1", "standard", "10Gi")
+	bound.Spec.ClaimRef = &core.ObjectReference{Namespace: "demo", Name: "data-pg-0"}
+	c := &rbacClient{
+		Client:    newTestClient(t, newVolume("released", "standard", "5Gi"), bound),
+		forbidden: map[string]bool{"PersistentVolumeClaimList": true},
+	}
+	report, err := collectStorage(context.TODO(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.NoClaimAccess || report.Total.Volumes != 2 {
+		t.Errorf("got %+v", report)
+	}
+	// the bound volume is not reported as an unbound, cluster scoped one
+	checkUsage(t, "standard/released", report.ByClass[storageClassKey{StorageClass: "standard"}], 0, 1, "0", "5Gi")
+	checkUsage(t, "standard/bound", report.ByClass[storageClassKey{StorageClass: "standard", Unattributed: true}], 0, 1, "0", "10Gi")
+
+	var buf bytes.Buffer
+	if err := printStorage(&buf, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"PERSISTENT VOLUME CLAIMS:   no access",
+		"standard        no access   -        1         -           10Gi",
+		"TOTAL           =           -        2         -           15Gi",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+)
+
+// testResources are the resource types served by the clusters the tests run against.
+var testResources = []*metav1.APIResourceList{
+	{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "namespaces", SingularName: "namespace", Kind: "Namespace", Verbs: []string{"list", "get"}},
+			{Name: "nodes", SingularName: "node", Kind: "Node", Verbs: []string{"list", "get"}},
+			{Name: "pods", SingularName: "pod", Namespaced: true, Kind: "Pod", Verbs: []string{"list", "get"}},
+			{Name: "persistentvolumeclaims", SingularName: "persistentvolumeclaim", Namespaced: true, Kind: "PersistentVolumeClaim", Verbs: []string{"list", "get"}},
+			{Name: "persistentvolumes", SingularName: "persistentvolume", Kind: "PersistentVolume", Verbs: []string{"list", "get"}},
+			{Name: "resourcequotas", SingularName: "resourcequota", Namespaced: true, Kind: "ResourceQuota", Verbs: []string{"list", "get"}},
+			{Name: "limitranges", SingularName: "limitrange", Namespaced: true, Kind: "LimitRange", Verbs: []string{"list", "get"}},
+		},
+	},
+	{
+		GroupVersion: "apps/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "statefulsets", SingularName: "statefulset", ShortNames: []string{"sts"}, Namespaced: true, Kind: "StatefulSet", Verbs: []string{"list", "get"}},
+			{Name: "replicasets", SingularName: "replicaset", ShortNames: []string{"rs"}, Namespaced: true, Kind: "ReplicaSet", Verbs: []string{"list", "get"}},
+			{Name: "deployments", SingularName: "deployment", ShortNames: []string{"deploy"}, Namespaced: true, Kind: "Deployment", Verbs: []string{"list", "get"}},
+		},
+	},
+	{
+		GroupVersion: "kubedb.com/v1alpha2",
+		APIResources: []metav1.APIResource{
+			{Name: "postgreses", SingularName: "postgres", ShortNames: []string{"pg"}, Namespaced: true, Kind: "Postgres", Verbs: []string{"list", "get"}},
+			{Name: "mongodbs", SingularName: "mongodb", ShortNames: []string{"mg"}, Namespaced: true, Kind: "MongoDB", Verbs: []string{"list", "get"}},
+		},
+	},
+}
+
+func testKubernetesInfo() *v1alpha1.KubernetesInfo {
+	return &v1alpha1.KubernetesInfo{
+		ClusterName: "test",
+		ClusterUID:  "cluster-uid",
+		Version:     &version.Info{GitVersion: "v1.21.1"},
+	}
+}
+
+// newTestArchive returns an archive of a cluster serving testResources with the
+// given objects. The kube-system namespace is always present, like in a real cluster.
+func newTestArchive(t *testing.T, objs ...runtime.Object) *Archive {
+	t.Helper()
+	a := &Archive{
+		KubernetesInfo:     testKubernetesInfo(),
+		Resources:          testResources,
+		PreferredResources: testResources,
+	}
+	kubeSystem := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: "cluster-uid"}}
+	for _, obj := range append([]runtime.Object{kubeSystem}, objs...) {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			a.Objects = append(a.Objects, *u)
+			continue
+		}
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := unstructured.Unstructured{Object: content}
+		u.SetGroupVersionKind(gvk)
+		a.Objects = append(a.Objects, u)
+	}
+	return a
+}
+
+// newTestClient returns a client of a cluster serving testResources with the given objects.
+func newTestClient(t *testing.T, objs ...runtime.Object) client.Client {
+	t.Helper()
+	c, err := newTestArchive(t, objs...).Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// parseObject parses a YAML manifest into an unstructured object.
+func parseObject(t *testing.T, manifest string) *unstructured.Unstructured {
+	t.Helper()
+	var u unstructured.Unstructured
+	if err := yaml.Unmarshal([]byte(manifest), &u.Object); err != nil {
+		t.Fatal(err)
+	}
+	return &u
+}
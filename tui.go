@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	"golang.org/x/term"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kmodules.xyz/resource-metrics/api"
+)
+
+const (
+	// same length as highlightOff, so tabwriter keeps the columns aligned
+	reverseVideo = "\033[00;7m"
+	tuiHelp      = "↑/↓ move   enter open   ← back   s sort   S reverse   / filter   q quit"
+)
+
+// tuiRow is a table row. open returns the view shown when the row is selected, or nil.
+type tuiRow struct {
+	cells []string
+	open  func() *tuiView
+}
+
+// tuiView is one level of the drill down: cluster → kind → namespace → object → role.
+type tuiView struct {
+	title  string
+	info   []string
+	header []string
+	rows   []tuiRow
+
+	cursor   int
+	offset   int
+	sortCol  int
+	sortDesc bool
+	filter   string
+}
+
+// visible returns the rows matching the filter in sort order.
+func (v *tuiView) visible() []tuiRow {
+	var rows []tuiRow
+	needle := strings.ToLower(v.filter)
+	for _, row := range v.rows {
+		if needle == "" || strings.Contains(strings.ToLower(strings.Join(row.cells, " ")), needle) {
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		less := compareCells(rows[i].cells[v.sortCol], rows[j].cells[v.sortCol])
+		if v.sortDesc {
+			return less > 0
+		}
+		return less < 0
+	})
+	return rows
+}
+
+// compareCells compares numbers and quantities by value and everything else as text.
+func compareCells(a, b string) int {
+	qa, errA := resource.ParseQuantity(a)
+	qb, errB := resource.ParseQuantity(b)
+	if errA == nil && errB == nil {
+		return qa.Cmp(qb)
+	}
+	return strings.Compare(a, b)
+}
+
+func resourceCells(rl core.ResourceList) []string {
+	return []string{rl.Cpu().String(), rl.Memory().String(), rl.Storage().String()}
+}
+
+func newKindsView(report *Report, r *Redactor) *tuiView {
+	v := &tuiView{
+		title:  "cluster",
+		header: []string{"KIND", "VERSION", "COUNT", "REPLICAS", "CPU", "MEMORY", "STORAGE"},
+	}
+	if report.ClusterID != "" {
+		v.title += " " + r.Hash(report.ClusterID)
+	}
+	var notes summaryNotes
+	for gvk := range report.Summaries {
+		gvk := gvk
+		cells, counted := summaryCells(report, gvk, &notes)
+		row := tuiRow{cells: append([]string{gvk.GroupKind().String(), gvk.Version}, cells...)}
+		if counted {
+			row.open = func() *tuiView {
+				return newNamespacesView(report, gvk)
+			}
+		}
+		v.rows = append(v.rows, row)
+	}
+	v.info = notes.Lines()
+	return v
+}
+
+func objectsOf(report *Report, gk schema.GroupKind, ns *string) []v1alpha1.GenericResource {
+	var result []v1alpha1.GenericResource
+	for _, obj := range report.Objects {
+		if obj.Spec.Group != gk.Group || obj.Spec.Kind != gk.Kind {
+			continue
+		}
+		if ns != nil && obj.Namespace != *ns {
+			continue
+		}
+		result = append(result, obj)
+	}
+	return result
+}
+
+func newNamespacesView(report *Report, gvk schema.GroupVersionKind) *tuiView {
+	v := &tuiView{
+		title:  "cluster › " + gvk.GroupKind().String(),
+		header: []string{"NAMESPACE", "COUNT", "REPLICAS", "CPU", "MEMORY", "STORAGE"},
+	}
+	type nsTotal struct {
+		count    int
+		replicas int64
+		limits   core.ResourceList
+	}
+	totals := map[string]*nsTotal{}
+	for _, obj := range objectsOf(report, gvk.GroupKind(), nil) {
+		t, ok := totals[obj.Namespace]
+		if !ok {
+			t = &nsTotal{}
+			totals[obj.Namespace] = t
+		}
+		t.count++
+		t.replicas += obj.Spec.Replicas
+		t.limits = api.AddResourceList(t.limits, obj.Spec.AppResource.Limits)
+	}
+	for ns, t := range totals {
+		ns := ns
+		name := ns
+		if name == "" {
+			name = noneValue
+		}
+		cells := append([]string{name, strconv.Itoa(t.count), strconv.FormatInt(t.replicas, 10)}, resourceCells(t.limits)...)
+		v.rows = append(v.rows, tuiRow{cells: cells, open: func() *tuiView {
+			return newObjectsView(report, gvk, ns)
+		}})
+	}
+	return v
+}
+
+func newObjectsView(report *Report, gvk schema.GroupVersionKind, ns string) *tuiView {
+	v := &tuiView{
+		title:  "cluster › " + gvk.GroupKind().String() + " › " + ns,
+		header: []string{"NAME", "MODE", "REPLICAS", "STATUS", "CPU", "MEMORY", "STORAGE"},
+	}
+	for _, obj := range objectsOf(report, gvk.GroupKind(), &ns) {
+		obj := obj
+		mode := obj.Spec.Mode
+		if mode == "" {
+			mode = "-"
+		}
+		cells := append([]string{obj.Name, mode, strconv.FormatInt(obj.Spec.Replicas, 10), obj.Status.Status.String()},
+			resourceCells(obj.Spec.AppResource.Limits)...)
+		v.rows = append(v.rows, tuiRow{cells: cells, open: func() *tuiView {
+			return newObjectView(v.title, obj)
+		}})
+	}
+	return v
+}
+
+// newObjectView shows the kstatus, owners and the resources of each role of an object.
+func newObjectView(parent string, obj v1alpha1.GenericResource) *tuiView {
+	v := &tuiView{
+		title:  parent + " › " + obj.Name,
+		header: []string{"ROLE", "REPLICAS", "CPU REQUEST", "CPU LIMIT", "MEMORY REQUEST", "MEMORY LIMIT", "STORAGE"},
+	}
+	v.info = append(v.info,
+		"Status:   "+obj.Status.Status.String(),
+		"Message:  "+obj.Status.Message,
+		"Mode:     "+obj.Spec.Mode,
+		"Created:  "+obj.CreationTimestamp.String(),
+	)
+	if len(obj.OwnerReferences) == 0 {
+		v.info = append(v.info, "Owners:   "+noneValue)
+	}
+	for i, ref := range obj.OwnerReferences {
+		label := "          "
+		if i == 0 {
+			label = "Owners:   "
+		}
+		controller := ""
+		if ref.Controller != nil && *ref.Controller {
+			controller = " (controller)"
+		}
+		v.info = append(v.info, label+ref.Kind+"/"+ref.Name+controller)
+	}
+
+	roles := map[v1alpha1.PodRole]bool{}
+	for role := range obj.Spec.RoleResourceLimits {
+		roles[role] = true
+	}
+	for role := range obj.Spec.RoleResourceRequests {
+		roles[role] = true
+	}
+	for role := range roles {
+		name := string(role)
+		if name == "" {
+			name = "default"
+		}
+		req, lim := obj.Spec.RoleResourceRequests[role], obj.Spec.RoleResourceLimits[role]
+		v.rows = append(v.rows, tuiRow{cells: []string{
+			name,
+			strconv.FormatInt(obj.Spec.RoleReplicas[role], 10),
+			req.Cpu().String(),
+			lim.Cpu().String(),
+			req.Memory().String(),
+			lim.Memory().String(),
+			lim.Storage().String(),
+		}})
+	}
+	return v
+}
+
+// tui is a keyboard driven browser for a Report.
+type tui struct {
+	out    io.Writer
+	stack  []*tuiView
+	height int
+
+	// filter text being typed, if filtering is true
+	filtering bool
+	input     string
+}
+
+func (t *tui) current() *tuiView {
+	return t.stack[len(t.stack)-1]
+}
+
+func (t *tui) render() error {
+	v := t.current()
+	rows := v.visible()
+
+	var buf bytes.Buffer
+	buf.WriteString(clearScreen)
+	_, _ = fmt.Fprintf(&buf, "%s\n", v.title)
+	for _, line := range v.info {
+		_, _ = fmt.Fprintf(&buf, "%s\n", line)
+	}
+	buf.WriteString("\n")
+
+	// title, info, blank line, header, status line and help
+	pageSize := t.height - len(v.info) - 5
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	if v.cursor >= len(rows) {
+		v.cursor = len(rows) - 1
+	}
+	if v.cursor < 0 {
+		v.cursor = 0
+	}
+	if v.cursor < v.offset {
+		v.offset = v.cursor
+	}
+	if v.cursor >= v.offset+pageSize {
+		v.offset = v.cursor - pageSize + 1
+	}
+
+	const padding = 3
+	w := tabwriter.NewWriter(&buf, 0, 0, padding, ' ', tabwriter.TabIndent)
+	for i, h := range v.header {
+		if i == v.sortCol {
+			if v.sortDesc {
+				h += "↓"
+			} else {
+				h += "↑"
+			}
+		}
+		_, _ = fmt.Fprintf(w, "%s%s%s\t", highlightOff, h, resetColor)
+	}
+	_, _ = fmt.Fprintln(w)
+	for i := v.offset; i < len(rows) && i < v.offset+pageSize; i++ {
+		// the marker is set for every row, so that the columns stay aligned
+		marker := highlightOff
+		if i == v.cursor {
+			marker = reverseVideo
+		}
+		for _, cell := range rows[i].cells {
+			_, _ = fmt.Fprintf(w, "%s%s%s\t", marker, cell, resetColor)
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	status := fmt.Sprintf("%d/%d", len(rows), len(v.rows))
+	if t.filtering {
+		status += "   filter: " + t.input + "_"
+	} else if v.filter != "" {
+		status += "   filter: " + v.filter
+	}
+	_, _ = fmt.Fprintf(&buf, "\n%s\n%s", status, tuiHelp)
+
+	// the terminal is in raw mode, so every line needs a carriage return
+	_, err := t.out.Write(bytes.ReplaceAll(buf.Bytes(), []byte("\n"), []byte("\r\n")))
+	return err
+}
+
+type tuiKey int
+
+const (
+	keyRune tuiKey = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyInterrupt
+)
+
+type tuiInput struct {
+	key tuiKey
+	r   rune
+}
+
+// escapeTimeout is how long readKeys waits for the rest of an escape sequence,
+// before ESC is taken as a key on its own.
+const escapeTimeout = 50 * time.Millisecond
+
+// readKeys decodes the raw terminal input into keys.
+func readKeys(in io.Reader, keys chan<- tuiInput) {
+	defer close(keys)
+	runes := make(chan rune)
+	go func() {
+		defer close(runes)
+		br := bufio.NewReader(in)
+		for {
+			r, _, err := br.ReadRune()
+			if err != nil {
+				return
+			}
+			runes <- r
+		}
+	}()
+	// the rest of an escape sequence arrives right after ESC, unlike a key typed after it
+	next := func() (rune, bool) {
+		select {
+		case r, ok := <-runes:
+			return r, ok
+		case <-time.After(escapeTimeout):
+			return 0, false
+		}
+	}
+
+	var pending []rune
+	for {
+		var r rune
+		if len(pending) > 0 {
+			r, pending = pending[0], pending[1:]
+		} else {
+			var ok bool
+			if r, ok = <-runes; !ok {
+				return
+			}
+		}
+		switch r {
+		case 3: // Ctrl+C
+			keys <- tuiInput{key: keyInterrupt}
+		case '\r', '\n':
+			keys <- tuiInput{key: keyEnter}
+		case 127, 8:
+			keys <- tuiInput{key: keyBackspace}
+		case 27:
+			r1, ok := next()
+			if !ok {
+				keys <- tuiInput{key: keyEscape}
+				continue
+			}
+			if r1 != '[' {
+				keys <- tuiInput{key: keyEscape}
+				pending = append(pending, r1)
+				continue
+			}
+			r2, ok := next()
+			if !ok {
+				keys <- tuiInput{key: keyEscape}
+				pending = append(pending, r1)
+				continue
+			}
+			switch r2 {
+			case 'A':
+				keys <- tuiInput{key: keyUp}
+			case 'B':
+				keys <- tuiInput{key: keyDown}
+			case 'C':
+				keys <- tuiInput{key: keyRight}
+			case 'D':
+				keys <- tuiInput{key: keyLeft}
+			}
+		default:
+			keys <- tuiInput{key: keyRune, r: r}
+		}
+	}
+}
+
+// handle applies a key and returns false if the TUI should exit.
+func (t *tui) handle(in tuiInput) bool {
+	v := t.current()
+	if t.filtering {
+		switch in.key {
+		case keyEnter:
+			v.filter, t.filtering = t.input, false
+			v.cursor, v.offset = 0, 0
+		case keyEscape:
+			t.filtering = false
+		case keyBackspace:
+			if rs := []rune(t.input); len(rs) > 0 {
+				t.input = string(rs[:len(rs)-1])
+			}
+		case keyRune:
+			t.input += string(in.r)
+		case keyInterrupt:
+			return false
+		}
+		return true
+	}
+
+	switch in.key {
+	case keyInterrupt:
+		return false
+	case keyUp:
+		v.cursor--
+	case keyDown:
+		v.cursor++
+	case keyEnter, keyRight:
+		rows := v.visible()
+		if v.cursor < len(rows) && rows[v.cursor].open != nil {
+			next := rows[v.cursor].open()
+			t.stack = append(t.stack, next)
+		}
+	case keyLeft, keyEscape, keyBackspace:
+		if len(t.stack) > 1 {
+			t.stack = t.stack[:len(t.stack)-1]
+		}
+	case keyRune:
+		switch in.r {
+		case 'q':
+			return false
+		case 'k':
+			v.cursor--
+		case 'j':
+			v.cursor++
+		case 'h':
+			return t.handle(tuiInput{key: keyLeft})
+		case 'l':
+			return t.handle(tuiInput{key: keyEnter})
+		case 's':
+			v.sortCol = (v.sortCol + 1) % len(v.header)
+		case 'S':
+			v.sortDesc = !v.sortDesc
+		case '/':
+			t.filtering, t.input = true, v.filter
+		}
+	}
+	return true
+}
+
+// runTUI browses the report until the user quits or ctx is done.
+// It requires stdin and stdout to be a terminal.
+func runTUI(ctx context.Context, report *Report, r *Redactor) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("--tui requires a terminal")
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = term.Restore(fd, oldState)
+		_, _ = fmt.Fprint(os.Stdout, clearScreen)
+	}()
+
+	t := &tui{out: os.Stdout, stack: []*tuiView{newKindsView(report, r)}}
+	keys := make(chan tuiInput)
+	go readKeys(os.Stdin, keys)
+	for {
+		_, t.height, err = term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			t.height = 24
+		}
+		if err := t.render(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case in, ok := <-keys:
+			if !ok || !t.handle(in) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func collectKeys(t *testing.T, in io.Reader) []tuiInput {
+	t.Helper()
+	keys := make(chan tuiInput)
+	go readKeys(in, keys)
+	var result []tuiInput
+	for k := range keys {
+		result = append(result, k)
+	}
+	return result
+}
+
+func TestReadKeys(t *testing.T) {
+	got := collectKeys(t, strings.NewReader("\x1b[A\x1b[Bq\r\x1bx\x7f\x03\x1b"))
+	want := []tuiInput{
+		{key: keyUp}, {key: keyDown}, {key: keyRune, r: 'q'}, {key: keyEnter},
+		// ESC followed by another key is both keys
+		{key: keyEscape}, {key: keyRune, r: 'x'},
+		{key: keyBackspace}, {key: keyInterrupt}, {key: keyEscape},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("key %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadKeysSplitSequence(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		// an arrow key may arrive in more than one read
+		_, _ = w.Write([]byte("\x1b"))
+		_, _ = w.Write([]byte("[C"))
+		// a lone ESC is a key once nothing follows it
+		_, _ = w.Write([]byte("\x1b"))
+		time.Sleep(2 * escapeTimeout)
+		_, _ = w.Write([]byte("["))
+		_ = w.Close()
+	}()
+	got := collectKeys(t, r)
+	want := []tuiInput{{key: keyRight}, {key: keyEscape}, {key: keyRune, r: '['}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("key %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNewKindsView(t *testing.T) {
+	r := &Redactor{salt: []byte("s")}
+	v := newKindsView(newMarkedReport(4), r)
+	if v.title != "cluster "+r.Hash("cluster-uid") {
+		t.Errorf("title = %q", v.title)
+	}
+	if len(v.info) != 4 {
+		t.Errorf("info = %q", v.info)
+	}
+	rows := map[string]tuiRow{}
+	for _, row := range v.rows {
+		rows[row.cells[0]] = row
+	}
+	if row := rows["MySQL.kubedb.com"]; row.cells[2] != "no access" || row.open != nil {
+		t.Errorf("MySQL = %v, open %v", row.cells, row.open != nil)
+	}
+	if row := rows["Pod"]; row.cells[2] != "4+" || row.open == nil {
+		t.Errorf("Pod = %v", row.cells)
+	}
+	if row := rows["Postgres.kubedb.com"]; row.cells[2] != "2*" {
+		t.Errorf("Postgres = %v", row.cells)
+	}
+	if row := rows["MongoDB.kubedb.com"]; strings.Join(row.cells[3:], " ") != "- - - -" {
+		t.Errorf("MongoDB = %v", row.cells)
+	}
+
+	if v := newKindsView(newMarkedReport(4), nil); v.title != "cluster cluster-uid" {
+		t.Errorf("title without redaction = %q", v.title)
+	}
+}
+
+func TestTUIHandle(t *testing.T) {
+	tu := &tui{stack: []*tuiView{newKindsView(newMarkedReport(4), nil)}}
+	// sorted by kind: MongoDB, MySQL, Pod, Postgres, Widget
+	tu.handle(tuiInput{key: keyDown})
+	tu.handle(tuiInput{key: keyEnter})
+	if len(tu.stack) != 1 {
+		t.Error("a type without access must not open")
+	}
+	tu.handle(tuiInput{key: keyDown})
+	tu.handle(tuiInput{key: keyEnter})
+	if len(tu.stack) != 2 || !strings.HasSuffix(tu.current().title, "Pod") {
+		t.Fatalf("opened %d views", len(tu.stack))
+	}
+	tu.handle(tuiInput{key: keyEscape})
+	if len(tu.stack) != 1 {
+		t.Error("escape did not go back")
+	}
+	for _, r := range "/my\r" {
+		key := tuiInput{key: keyRune, r: r}
+		if r == '\r' {
+			key = tuiInput{key: keyEnter}
+		}
+		tu.handle(key)
+	}
+	if rows := tu.current().visible(); len(rows) != 1 || rows[0].cells[0] != "MySQL.kubedb.com" {
+		t.Errorf("filtered rows = %v", rows)
+	}
+	if tu.handle(tuiInput{key: keyRune, r: 'q'}) {
+		t.Error("q did not quit")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	clearScreen = "\033[H\033[2J"
+	// both markers have the same length, so tabwriter keeps the columns aligned
+	highlightOn  = "\033[1;33m"
+	highlightOff = "\033[0;00m"
+	resetColor   = "\033[0m"
+)
+
+// watchTable keeps the first and the previous report of a watch session, to
+// highlight changed cells and print the deltas since the session started.
+type watchTable struct {
+	baseline *Report
+	started  time.Time
+	previous map[schema.GroupVersionKind][]string
+}
+
+func signedQuantity(q resource.Quantity) string {
+	if q.Sign() > 0 {
+		return "+" + q.String()
+	}
+	return q.String()
+}
+
+// withDelta appends the change since the session started, eg, 4 (+1).
+func withDelta(cur, base resource.Quantity) string {
+	diff := cur.DeepCopy()
+	diff.Sub(base)
+	if diff.IsZero() {
+		return cur.String()
+	}
+	return fmt.Sprintf("%s (%s)", cur.String(), signedQuantity(diff))
+}
+
+// rows returns the cells of each type with the markers printReport uses and the
+// changes since the session started, and the markers that need an explanation.
+func (t *watchTable) rows(report *Report) (map[schema.GroupVersionKind][]string, summaryNotes) {
+	var notes summaryNotes
+	rows := map[schema.GroupVersionKind][]string{}
+	for gvk, rr := range report.Summaries {
+		cells, counted := summaryCells(report, gvk, &notes)
+		if counted {
+			base := t.baseline.Summaries[gvk]
+			if d := rr.Spec.Count - base.Spec.Count; d != 0 {
+				cells[0] += fmt.Sprintf(" (%+d)", d)
+			}
+			if d := rr.Spec.Replicas - base.Spec.Replicas; d != 0 && !report.MetadataOnly[gvk] {
+				cells[1] += fmt.Sprintf(" (%+d)", d)
+			}
+			if hasCalculator(gvk) && !report.MetadataOnly[gvk] {
+				rl, bl := rr.Spec.AppResource.Limits, base.Spec.AppResource.Limits
+				cells[2] = withDelta(*rl.Cpu(), *bl.Cpu())
+				cells[3] = withDelta(*rl.Memory(), *bl.Memory())
+				cells[4] = withDelta(*rl.Storage(), *bl.Storage())
+			}
+		}
+		rows[gvk] = append([]string{gvk.GroupVersion().String(), gvk.Kind}, cells...)
+	}
+	return rows, notes
+}
+
+// Print redraws the table. Cells that changed since the previous refresh are highlighted.
+func (t *watchTable) Print(out io.Writer, report *Report, refreshed time.Time, interval time.Duration) error {
+	if t.baseline == nil {
+		t.baseline = report
+		t.started = refreshed
+	}
+	rows, notes := t.rows(report)
+
+	gvks := make([]schema.GroupVersionKind, 0, len(rows))
+	for gvk := range rows {
+		gvks = append(gvks, gvk)
+	}
+	sort.Slice(gvks, func(i, j int) bool {
+		if gvks[i].Group == gvks[j].Group {
+			return gvks[i].Kind < gvks[j].Kind
+		}
+		return gvks[i].Group < gvks[j].Group
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(clearScreen)
+	_, _ = fmt.Fprintf(&buf, "Every %s: %s\n\n", interval, refreshed.Format(time.RFC1123))
+
+	const padding = 3
+	w := tabwriter.NewWriter(&buf, 0, 0, padding, ' ', tabwriter.TabIndent)
+	header := []string{"API VERSION", "KIND", "COUNT", "REPLICAS", "CPU", "MEMORY", "STORAGE"}
+	for _, h := range header {
+		_, _ = fmt.Fprintf(w, "%s%s%s\t", highlightOff, h, resetColor)
+	}
+	_, _ = fmt.Fprintln(w)
+	for _, gvk := range gvks {
+		prev, seen := t.previous[gvk]
+		for i, cell := range rows[gvk] {
+			marker := highlightOff
+			if t.previous != nil && (!seen || prev[i] != cell) {
+				marker = highlightOn
+			}
+			_, _ = fmt.Fprintf(w, "%s%s%s\t", marker, cell, resetColor)
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, line := range notes.Lines() {
+		_, _ = fmt.Fprintln(&buf, line)
+	}
+	_, _ = fmt.Fprintf(&buf, "\ndeltas are relative to %s\n", t.started.Format(time.RFC1123))
+
+	t.previous = rows
+	_, err := buf.WriteTo(out)
+	return err
+}
+
+// watch lists the selected types every interval and redraws the summary table until ctx is done.
+// If n is set, the changes between two refreshes are sent to its sinks.
+func watch(ctx context.Context, out io.Writer, c client.Client, ki *v1alpha1.KubernetesInfo, gvks []schema.GroupVersionKind, r *Redactor, opts CalculateOptions, interval time.Duration, n *notifier) error {
+	var table watchTable
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := collect(ctx, c, ki, gvks, r, opts)
+		if ctx.Err() != nil {
+			// --timeout or Ctrl+C ends the session
+			return nil
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "%sError: %v\n", clearScreen, err)
+		} else {
+			now := time.Now()
+			if err := table.Print(out, report, now, interval); err != nil {
+				return err
+			}
+			if n != nil {
+				if err := n.Notify(ctx, report, now); err != nil {
+					_, _ = fmt.Fprintf(out, "Warning: %v\n", err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	testPods     = core.SchemeGroupVersion.WithKind("Pod")
+	testPostgres = schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"}
+	testMongoDB  = schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "MongoDB"}
+	testMySQL    = schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "MySQL"}
+	testWidgets  = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+)
+
+func newSummary(count int, replicas int64, cpu string) v1alpha1.ResourceSummary {
+	var rr v1alpha1.ResourceSummary
+	rr.Spec.Count = count
+	rr.Spec.Replicas = replicas
+	rr.Spec.AppResource.Limits = core.ResourceList{core.ResourceCPU: resource.MustParse(cpu)}
+	return rr
+}
+
+// newMarkedReport returns a report with one type for each marker of the summary table.
+func newMarkedReport(pods int) *Report {
+	return &Report{
+		ClusterID: "cluster-uid",
+		Summaries: map[schema.GroupVersionKind]v1alpha1.ResourceSummary{
+			testPods:     newSummary(pods, int64(pods), "1"),
+			testPostgres: newSummary(2, 2, "2"),
+			testMongoDB:  newSummary(1, 0, "0"),
+			testMySQL:    {},
+			testWidgets:  newSummary(3, 0, "0"),
+		},
+		Access: map[schema.GroupVersionKind]Access{
+			testPods:     {ClusterWide: true},
+			testPostgres: {Namespaces: []string{"demo"}},
+			testMongoDB:  {ClusterWide: true},
+			testMySQL:    {},
+			testWidgets:  {ClusterWide: true},
+		},
+		Incomplete:   map[schema.GroupVersionKind]bool{testPods: true},
+		MetadataOnly: map[schema.GroupVersionKind]bool{testMongoDB: true, testWidgets: true},
+	}
+}
+
+func TestSummaryCells(t *testing.T) {
+	report := newMarkedReport(4)
+	tests := []struct {
+		gvk     schema.GroupVersionKind
+		want    string
+		counted bool
+	}{
+		{testPods, "4+ 4 1 0 0", true},
+		{testPostgres, "2* 2 2 0 0", true},
+		{testMongoDB, "1 - - - -", true},
+		{testMySQL, "no access - - - -", false},
+		{testWidgets, "3 - n/a n/a n/a", true},
+	}
+	var notes summaryNotes
+	for _, tt := range tests {
+		cells, counted := summaryCells(report, tt.gvk, &notes)
+		if got := strings.Join(cells, " "); got != tt.want || counted != tt.counted {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.gvk.Kind, got, counted, tt.want, tt.counted)
+		}
+	}
+	if len(notes.Lines()) != 4 {
+		t.Errorf("notes = %q", notes.Lines())
+	}
+}
+
+func TestWatchTablePrint(t *testing.T) {
+	var table watchTable
+	var buf bytes.Buffer
+	now := time.Date(2021, 11, 1, 10, 0, 0, 0, time.UTC)
+	if err := table.Print(&buf, newMarkedReport(4), now, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"no access", "4+", "2*", "n/a", "* listed only in the namespaces", "+ listing did not finish", "n/a: no resource calculator"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, highlightOn) {
+		t.Error("first refresh must not highlight cells")
+	}
+
+	buf.Reset()
+	if err := table.Print(&buf, newMarkedReport(5), now.Add(time.Minute), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	out = buf.String()
+	if !strings.Contains(out, highlightOn+"5+ (+1)"+resetColor) {
+		t.Errorf("changed count not highlighted with its delta:\n%q", out)
+	}
+	if !strings.Contains(out, highlightOff+"no access"+resetColor) {
+		t.Errorf("unchanged cell highlighted:\n%q", out)
+	}
+}
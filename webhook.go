@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tamalsaha/resource-listing-summary/apis/reports/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// budgetValidator is a validating admission handler for the registered resource
+// types, eg, KubeDB databases. On create and update it computes the resources of
+// the incoming object with ToGenericResource, adds them to the live objects and
+// denies the request if that makes a policy rule fail for the incoming object.
+// This catches oversized objects before the operator creates their pods, which
+// ResourceQuota only sees afterwards.
+// The live objects are read from an informer cache, so a request does not list the cluster.
+type budgetValidator struct {
+	c      client.Reader
+	policy *Policy
+	gvks   []schema.GroupVersionKind
+}
+
+var _ admission.Handler = &budgetValidator{}
+
+func (v *budgetValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+	gvk := schema.GroupVersionKind{Group: req.Kind.Group, Version: req.Kind.Version, Kind: req.Kind.Kind}
+	if !hasCalculator(gvk) {
+		return admission.Allowed("no resource calculator for " + gvk.String())
+	}
+
+	var obj unstructured.Unstructured
+	if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(req.Namespace)
+	}
+	incoming, err := ToGenericResource(obj, gvk)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	objects, err := v.liveObjects(ctx, req.Namespace, gvk.GroupKind(), obj.GetName())
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	objects = append(objects, *incoming)
+
+	ref := objectRef(*incoming)
+	var msgs []string
+	for _, violation := range v.policy.Check(objects) {
+		for _, r := range violation.Objects {
+			if r == ref {
+				msgs = append(msgs, fmt.Sprintf("%s (%s): %s", violation.Rule, violation.Group, violation.Message))
+				break
+			}
+		}
+	}
+	if len(msgs) > 0 {
+		return admission.Denied("resource budget exceeded: " + strings.Join(msgs, "; "))
+	}
+	return admission.Allowed("")
+}
+
+// liveObjects lists the registered types, skipping the object that is being updated.
+// Only the request namespace is listed, unless a rule aggregates across namespaces.
+func (v *budgetValidator) liveObjects(ctx context.Context, ns string, gk schema.GroupKind, name string) ([]v1alpha1.GenericResource, error) {
+	listNs := ns
+	for _, rule := range v.policy.Rules {
+		if rule.Per != "" && rule.Per != "namespace" && rule.Per != "object" {
+			listNs = metav1.NamespaceAll
+			break
+		}
+	}
+
+	var objects []v1alpha1.GenericResource
+	for _, gvk := range v.gvks {
+		var list unstructured.UnstructuredList
+		list.SetGroupVersionKind(gvk)
+		err := v.c.List(ctx, &list, client.InNamespace(listNs))
+		if meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to list %v: %w", gvk, err)
+		}
+		for _, item := range list.Items {
+			if gvk.GroupKind() == gk && item.GetName() == name && item.GetNamespace() == ns {
+				continue
+			}
+			genres, err := ToGenericResource(item, gvk)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, *genres)
+		}
+	}
+	return objects, nil
+}
+
+// watchLiveObjects registers an informer for each type, so the cache starts them
+// with the manager instead of on the first admission request. Types that are not
+// served by the cluster are skipped.
+func watchLiveObjects(ctx context.Context, c cache.Cache, gvks []schema.GroupVersionKind) error {
+	for _, gvk := range gvks {
+		var obj unstructured.Unstructured
+		obj.SetGroupVersionKind(gvk)
+		if _, err := c.GetInformer(ctx, &obj); meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to watch %v: %w", gvk, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newPostgres(t *testing.T, ns, name, cpu string) runtime.Object {
+	return parseObject(t, `
+apiVersion: kubedb.com/v1alpha2
+kind: Postgres
+metadata:
+  namespace: `+ns+`
+  name: `+name+`
+spec:
+  replicas: 1
+  podTemplate:
+    spec:
+      resources:
+        requests:
+          cpu: "`+cpu+`"
+`)
+}
+
+func admissionRequest(t *testing.T, op admissionv1.Operation, obj runtime.Object) admission.Request {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: op,
+		Kind:      metav1.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"},
+		Namespace: o.GetNamespace(),
+		Name:      o.GetName(),
+		Object:    runtime.RawExtension{Raw: data},
+	}}
+}
+
+func TestBudgetValidator(t *testing.T) {
+	policy, err := LoadPolicy(writePolicy(t, `
+rules:
+- name: budget
+  kinds: ["Postgres.kubedb.com"]
+  maxRequests:
+    cpu: "3"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &budgetValidator{
+		c:      newTestClient(t, newPostgres(t, "demo", "a", "2")),
+		policy: policy,
+		gvks:   []schema.GroupVersionKind{{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"}},
+	}
+
+	tests := []struct {
+		name    string
+		req     admission.Request
+		allowed bool
+	}{
+		{"create over budget", admissionRequest(t, admissionv1.Create, newPostgres(t, "demo", "b", "2")), false},
+		{"create within budget", admissionRequest(t, admissionv1.Create, newPostgres(t, "demo", "b", "1")), true},
+		{"create in other namespace", admissionRequest(t, admissionv1.Create, newPostgres(t, "other", "b", "2")), true},
+		// the live object is replaced by the incoming one
+		{"update", admissionRequest(t, admissionv1.Update, newPostgres(t, "demo", "a", "3")), true},
+		{"update over budget", admissionRequest(t, admissionv1.Update, newPostgres(t, "demo", "a", "4")), false},
+		{"delete", admissionRequest(t, admissionv1.Delete, newPostgres(t, "demo", "b", "8")), true},
+	}
+	for _, tt := range tests {
+		resp := v.Handle(context.TODO(), tt.req)
+		if resp.Allowed != tt.allowed {
+			t.Errorf("%s: allowed = %v, want %v (%v)", tt.name, resp.Allowed, tt.allowed, resp.Result)
+		}
+		if !resp.Allowed && !strings.Contains(string(resp.Result.Reason), "budget (demo): requests cpu") {
+			t.Errorf("%s: reason = %q", tt.name, resp.Result.Reason)
+		}
+	}
+}
+
+// informerCache records the types an informer is requested for.
+type informerCache struct {
+	cache.Cache
+	mapper meta.RESTMapper
+	kinds  []string
+}
+
+func (c *informerCache) GetInformer(_ context.Context, obj client.Object) (cache.Informer, error) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if _, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return nil, err
+	}
+	c.kinds = append(c.kinds, gvk.Kind)
+	return nil, nil
+}
+
+func TestWatchLiveObjects(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	postgres := schema.GroupVersionKind{Group: "kubedb.com", Version: "v1alpha2", Kind: "Postgres"}
+	mapper.Add(postgres, meta.RESTScopeNamespace)
+	c := &informerCache{mapper: mapper}
+
+	gvks := []schema.GroupVersionKind{postgres, {Group: "kubedb.com", Version: "v1alpha2", Kind: "MySQL"}}
+	if err := watchLiveObjects(context.TODO(), c, gvks); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(c.kinds, ",") != "Postgres" {
+		t.Errorf("watched %v, want [Postgres]", c.kinds)
+	}
+}